@@ -0,0 +1,46 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/graph"
+	"barrettotte/questlines/models"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// GetQuestlineAnalysisHandler handles GET /api/questlines/{id}/analysis
+func GetQuestlineAnalysisHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
+
+	weighted, err := parseBoolParam(r, "weighted", false)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid weighted flag")
+		return
+	}
+
+	ql, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	analysis, err := graph.Analyze(ql, weighted)
+	if err != nil {
+		if errors.Is(err, graph.ErrCycle) {
+			respondError(w, http.StatusUnprocessableEntity, err.Error())
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, analysis)
+}
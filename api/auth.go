@@ -0,0 +1,369 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookieName = "questlines_session"
+	sessionDuration   = 30 * 24 * time.Hour
+
+	minUsernameLength = 3
+	maxUsernameLength = 64
+	minPasswordLength = 8
+)
+
+// AllowSignup permits registering new users once at least one user exists
+var AllowSignup = true
+
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type SessionInfo struct {
+	User    *models.User `json:"user"`
+	Token   string       `json:"token"`
+	Expires time.Time    `json:"expires"`
+}
+
+// helper for getting session or API token from bearer header, cookie, or calendar feed query,
+// and whether it came from the query
+func requestToken(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token), false
+		}
+		return "", false
+	}
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		return cookie.Value, false
+	}
+	// calendar apps can't send headers, so feeds accept an API token in the query
+	if strings.HasSuffix(r.URL.Path, ".ics") {
+		if token := r.URL.Query().Get("token"); auth.IsApiToken(token) {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+// helper for starting a new session and setting its cookie
+func startSession(w http.ResponseWriter, r *http.Request, user *models.User) (*SessionInfo, error) {
+	token, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(sessionDuration)
+
+	if err := db.CreateSession(r.Context(), user.Id, auth.HashToken(token), expires); err != nil {
+		return nil, err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return &SessionInfo{User: user, Token: token, Expires: expires}, nil
+}
+
+// helper for checking the current user has at least a role on a questline, responds with an error if not
+func authorizeQuestline(w http.ResponseWriter, r *http.Request, id string, required string) bool {
+	role, err := db.GetQuestlineRole(r.Context(), id, auth.UserFrom(r.Context()).Id)
+	return checkRole(w, role, err, required)
+}
+
+// helper for checking the current user has at least a role on a questline in the trash
+func authorizeDeletedQuestline(w http.ResponseWriter, r *http.Request, id string, required string) bool {
+	role, err := db.GetDeletedQuestlineRole(r.Context(), id, auth.UserFrom(r.Context()).Id)
+	return checkRole(w, role, err, required)
+}
+
+// helper for responding with an error if a role on a questline is missing or below the required role
+func checkRole(w http.ResponseWriter, role string, err error, required string) bool {
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return false
+	}
+
+	// do not reveal questlines of other users
+	if role == "" {
+		respondError(w, http.StatusNotFound, "Questline not found")
+		return false
+	}
+	if !models.RoleAtLeast(role, required) {
+		respondError(w, http.StatusForbidden, fmt.Sprintf("Questline requires %s access", required))
+		return false
+	}
+	return true
+}
+
+// helper for checking the current user may access prerequisites in other questlines, responds with an error if not
+func authorizeExternalDependencies(w http.ResponseWriter, r *http.Request, ql *models.Questline) bool {
+	if err := checkExternalDependencies(r, ql); err != nil {
+		respondRequestError(w, err)
+		return false
+	}
+	return true
+}
+
+// helper for checking the current user may access prerequisites in other questlines
+func checkExternalDependencies(r *http.Request, ql *models.Questline) error {
+	user := auth.UserFrom(r.Context())
+
+	for _, d := range ql.ExternalDependencies {
+		role, err := db.GetQuestRole(r.Context(), d.From.QuestId, user.Id)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+		if !models.RoleAtLeast(role, models.RoleViewer) {
+			return newRequestError(http.StatusBadRequest, fmt.Sprintf("External prerequisite quest %s not found", d.From.QuestId))
+		}
+	}
+	return nil
+}
+
+// helper for checking the current user may access questlines that quests are broken down into, responds with an error if not
+func authorizeChildQuestlines(w http.ResponseWriter, r *http.Request, ql *models.Questline, before *models.Questline) bool {
+	if err := checkChildQuestlines(r, ql, before); err != nil {
+		respondRequestError(w, err)
+		return false
+	}
+	return true
+}
+
+// helper for checking the current user may access questlines that quests are broken down into.
+// Only links that are new or changed since before are checked, so existing links don't block editing the questline
+func checkChildQuestlines(r *http.Request, ql *models.Questline, before *models.Questline) error {
+	user := auth.UserFrom(r.Context())
+
+	linked := make(map[string]string)
+	if before != nil {
+		for _, q := range before.Quests {
+			linked[q.Id] = q.ChildQuestlineId
+		}
+	}
+
+	for _, q := range ql.Quests {
+		if q.ChildQuestlineId == "" || linked[q.Id] == q.ChildQuestlineId {
+			continue
+		}
+		role, err := db.GetQuestlineRole(r.Context(), q.ChildQuestlineId, user.Id)
+		if err != nil && !errors.Is(err, db.ErrNotFound) {
+			return err
+		}
+		if !models.RoleAtLeast(role, models.RoleViewer) {
+			return newRequestError(http.StatusBadRequest, fmt.Sprintf("Child questline %s of quest %s not found", q.ChildQuestlineId, q.Id))
+		}
+	}
+	return nil
+}
+
+// helper for checking if a request method only reads data
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// authenticates a request made with a personal API token, enforcing its scope
+func authenticateApiToken(w http.ResponseWriter, r *http.Request, token string, fromQuery bool) (*http.Request, bool) {
+	user, scope, err := db.GetApiTokenUser(r.Context(), auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusUnauthorized, "Invalid or expired API token")
+		} else {
+			respondDbError(w, err)
+		}
+		return nil, false
+	}
+
+	if scope != models.ScopeWrite && !isReadOnlyMethod(r.Method) {
+		respondError(w, http.StatusForbidden, "API token is read-only")
+		return nil, false
+	}
+	// tokens in the query end up in calendar app settings and proxy logs, so they must not be able to write
+	if fromQuery && scope != models.ScopeRead {
+		respondError(w, http.StatusForbidden, "API tokens in the query must be read-only")
+		return nil, false
+	}
+	return r.WithContext(auth.WithScope(auth.WithUser(r.Context(), user), scope)), true
+}
+
+// Authenticate is middleware that requires a valid session or API token from a bearer token or cookie
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, fromQuery := requestToken(r)
+		if token == "" {
+			respondError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		if auth.IsApiToken(token) {
+			if authed, ok := authenticateApiToken(w, r, token, fromQuery); ok {
+				next.ServeHTTP(w, authed)
+			}
+			return
+		}
+
+		user, err := db.GetSessionUser(r.Context(), auth.HashToken(token))
+		if err != nil {
+			if errors.Is(err, db.ErrNotFound) {
+				respondError(w, http.StatusUnauthorized, "Invalid or expired session")
+			} else {
+				respondDbError(w, err)
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+	})
+}
+
+// RequireSession is middleware that rejects requests authenticated with an API token
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.ScopeFrom(r.Context()) != "" {
+			respondError(w, http.StatusForbidden, "API tokens cannot be used for this request")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RegisterHandler handles POST /api/auth/register
+func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+
+	if !decodeJSON(w, r, &creds) {
+		return
+	}
+
+	creds.Username = strings.TrimSpace(creds.Username)
+	if len(creds.Username) < minUsernameLength || len(creds.Username) > maxUsernameLength {
+		respondError(w, http.StatusBadRequest,
+			fmt.Sprintf("Username must be between %d and %d characters", minUsernameLength, maxUsernameLength),
+		)
+		return
+	}
+	if len(creds.Password) < minPasswordLength {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+		return
+	}
+
+	// first user can always register
+	count, err := db.CountUsers(r.Context())
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	if count > 0 && !AllowSignup {
+		respondError(w, http.StatusForbidden, "Registration is disabled")
+		return
+	}
+
+	hash, err := auth.HashPassword(creds.Password)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Registering user", "username", creds.Username)
+
+	user, err := db.CreateUser(r.Context(), &models.User{Username: creds.Username, PasswordHash: hash})
+	if err != nil {
+		if errors.Is(err, db.ErrUsernameTaken) {
+			respondError(w, http.StatusConflict, "Username already taken")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	session, err := startSession(w, r, user)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, session)
+}
+
+// LoginHandler handles POST /api/auth/login
+func LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var creds Credentials
+
+	if !decodeJSON(w, r, &creds) {
+		return
+	}
+
+	user, err := db.GetUserByUsername(r.Context(), strings.TrimSpace(creds.Username))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusUnauthorized, "Invalid username or password")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	valid, err := auth.CheckPassword(creds.Password, user.PasswordHash)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	if !valid {
+		respondError(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+
+	if err := db.DeleteExpiredSessions(r.Context()); err != nil {
+		slog.WarnContext(r.Context(), "Failed to delete expired sessions", "error", err)
+	}
+
+	session, err := startSession(w, r, user)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, session)
+}
+
+// LogoutHandler handles POST /api/auth/logout
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	token, _ := requestToken(r)
+	if err := db.DeleteSession(r.Context(), auth.HashToken(token)); err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	respondJSON(w, http.StatusOK, Message{Message: "Logged out successfully"})
+}
+
+// CurrentUserHandler handles GET /api/auth/me
+func CurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, auth.UserFrom(r.Context()))
+}
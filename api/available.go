@@ -0,0 +1,60 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/graph"
+	"barrettotte/questlines/models"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// GetAvailableQuestsHandler handles GET /api/questlines/{id}/available
+func GetAvailableQuestsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
+
+	ql, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, graph.Available(ql))
+}
+
+// GetNextQuestsHandler handles GET /api/next
+func GetNextQuestsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed < 0 {
+			respondError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+
+	user := auth.UserFrom(r.Context())
+
+	// quests are ranked across questlines, so prerequisites of quests in other questlines count as unblocking them
+	qls, err := db.GetUserQuestlines(r.Context(), user.Id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	next := graph.AvailableAcross(qls)
+
+	if limit > 0 && len(next) > limit {
+		next = next[:limit]
+	}
+	respondJSON(w, http.StatusOK, next)
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/logging"
+	"barrettotte/questlines/models"
+	"log/slog"
+	"net/http"
+)
+
+// BatchHandler handles POST /api/batch, applying all operations or none of them
+func BatchHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.BatchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Applying batch", "operations", len(req.Operations))
+	logging.Payload(r.Context(), "Batch to apply", req)
+
+	if errs := req.Validate(); len(errs) > 0 {
+		respondInvalid(w, errs)
+		return
+	}
+
+	// every questline must be editable before anything is applied
+	authorized := make(map[string]bool)
+	for _, op := range req.Operations {
+		if authorized[op.QuestlineId] {
+			continue
+		}
+		if !authorizeQuestline(w, r, op.QuestlineId, models.RoleEditor) {
+			return
+		}
+		authorized[op.QuestlineId] = true
+	}
+
+	results, before, after, err := db.ApplyBatch(r.Context(), req.Operations)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	resp := models.BatchResponse{Results: results, Questlines: make([]models.Questline, 0, len(after))}
+	for i := range after {
+		publishChanges(r, before[i], after[i])
+		updateParentQuests(r, after[i].Id)
+		resp.Questlines = append(resp.Questlines, *after[i])
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/ical"
+	"barrettotte/questlines/models"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// helper for writing an iCalendar feed
+func respondCalendar(w http.ResponseWriter, r *http.Request, name string, questlines []*models.Questline) {
+	asEvents, err := parseBoolParam(r, "events", false)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid events flag")
+		return
+	}
+
+	feed := ical.Feed(name, questlines, ical.Options{Events: asEvents}, time.Now())
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(feed))
+}
+
+// QuestlineCalendarHandler handles GET /api/questlines/{id}/calendar.ics
+func QuestlineCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
+
+	ql, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondCalendar(w, r, ql.Name, []*models.Questline{ql})
+}
+
+// CalendarHandler handles GET /api/calendar.ics
+func CalendarHandler(w http.ResponseWriter, r *http.Request) {
+	infos, err := db.GetQuestlineInfos(r.Context(), auth.UserFrom(r.Context()).Id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	questlines := make([]*models.Questline, 0, len(infos))
+	for _, info := range infos {
+		ql, err := db.GetQuestline(r.Context(), info.Id)
+		if err != nil {
+			respondDbError(w, err)
+			return
+		}
+		questlines = append(questlines, ql)
+	}
+	respondCalendar(w, r, "Questlines", questlines)
+}
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/digest"
+	"barrettotte/questlines/models"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP server digests are sent through, disabled if no host
+var DigestConfig digest.Config
+
+// least time between emails sent on request to the same user, confirmation codes or digests
+var DigestEmailInterval = 5 * time.Minute
+
+type DigestRequest struct {
+	Email     string `json:"email"`
+	Frequency string `json:"frequency"` // daily or weekly
+}
+
+type DigestConfirmRequest struct {
+	Code string `json:"code"` // emailed after subscribing
+}
+
+// getOwnDigestSubscription fetches digest subscription of current user, responding with an error if not subscribed
+func getOwnDigestSubscription(w http.ResponseWriter, r *http.Request) (*models.DigestSubscription, bool) {
+	sub, err := db.GetDigestSubscription(r.Context(), auth.UserFrom(r.Context()).Id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Not subscribed to digests")
+		} else {
+			respondDbError(w, err)
+		}
+		return nil, false
+	}
+	return sub, true
+}
+
+// claimDigestEmail checks a user was not emailed on request too recently, responding with an error if they were
+func claimDigestEmail(w http.ResponseWriter, r *http.Request, userId string) bool {
+	claimed, err := db.ClaimDigestEmail(r.Context(), userId, time.Now(), DigestEmailInterval)
+	if err != nil {
+		respondDbError(w, err)
+		return false
+	}
+	if !claimed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(DigestEmailInterval.Seconds())))
+		respondError(w, http.StatusTooManyRequests, fmt.Sprintf("Digest emails can be requested once every %s", DigestEmailInterval))
+		return false
+	}
+	return true
+}
+
+// GetDigestHandler handles GET /api/digest
+func GetDigestHandler(w http.ResponseWriter, r *http.Request) {
+	if sub, ok := getOwnDigestSubscription(w, r); ok {
+		respondJSON(w, http.StatusOK, sub)
+	}
+}
+
+// SetDigestHandler handles PUT /api/digest
+func SetDigestHandler(w http.ResponseWriter, r *http.Request) {
+	var toSet DigestRequest
+
+	if !decodeJSON(w, r, &toSet) {
+		return
+	}
+
+	address, err := mail.ParseAddress(toSet.Email)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid email address")
+		return
+	}
+	if toSet.Frequency == "" {
+		toSet.Frequency = models.DigestDaily // default
+	}
+	if toSet.Frequency != models.DigestDaily && toSet.Frequency != models.DigestWeekly {
+		respondError(w, http.StatusBadRequest, "Frequency must be one of daily or weekly")
+		return
+	}
+
+	sub := models.DigestSubscription{UserId: auth.UserFrom(r.Context()).Id, Email: address.Address, Frequency: toSet.Frequency}
+	slog.InfoContext(r.Context(), "Subscribing to digests", "user", sub.UserId, "frequency", sub.Frequency)
+
+	updated, err := db.SetDigestSubscription(r.Context(), &sub)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	// digests are only sent once the address is confirmed with an emailed code
+	if !updated.Confirmed && DigestConfig.Enabled() {
+		if !claimDigestEmail(w, r, sub.UserId) {
+			return
+		}
+		code, err := auth.NewToken()
+		if err != nil {
+			respondDbError(w, err)
+			return
+		}
+		if err := db.SetDigestConfirmCode(r.Context(), sub.UserId, auth.HashToken(code)); err != nil {
+			respondDbError(w, err)
+			return
+		}
+
+		slog.InfoContext(r.Context(), "Sending digest confirmation", "user", sub.UserId)
+		if err := digest.SendConfirmation(DigestConfig, updated.Email, code); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to send digest confirmation", "user", sub.UserId, "error", err)
+			respondError(w, http.StatusBadGateway, "Failed to send confirmation email")
+			return
+		}
+	}
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// ConfirmDigestHandler handles POST /api/digest/confirm
+func ConfirmDigestHandler(w http.ResponseWriter, r *http.Request) {
+	var toConfirm DigestConfirmRequest
+
+	if !decodeJSON(w, r, &toConfirm) {
+		return
+	}
+
+	userId := auth.UserFrom(r.Context()).Id
+	slog.InfoContext(r.Context(), "Confirming digest subscription", "user", userId)
+
+	confirmed, err := db.ConfirmDigestSubscription(r.Context(), userId, auth.HashToken(strings.TrimSpace(toConfirm.Code)))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusBadRequest, "Invalid confirmation code")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, confirmed)
+}
+
+// DeleteDigestHandler handles DELETE /api/digest
+func DeleteDigestHandler(w http.ResponseWriter, r *http.Request) {
+	userId := auth.UserFrom(r.Context()).Id
+	slog.InfoContext(r.Context(), "Unsubscribing from digests", "user", userId)
+
+	if err := db.DeleteDigestSubscription(r.Context(), userId); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Not subscribed to digests")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Unsubscribed from digests successfully"})
+}
+
+// PreviewDigestHandler handles GET /api/digest/preview
+func PreviewDigestHandler(w http.ResponseWriter, r *http.Request) {
+	sub, ok := getOwnDigestSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	d, err := digest.Build(r.Context(), *sub, time.Now())
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	text, html, err := digest.Render(d)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(html))
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(text))
+	}
+}
+
+// SendDigestHandler handles POST /api/digest/send
+func SendDigestHandler(w http.ResponseWriter, r *http.Request) {
+	if !DigestConfig.Enabled() {
+		respondError(w, http.StatusServiceUnavailable, "SMTP is not configured")
+		return
+	}
+	sub, ok := getOwnDigestSubscription(w, r)
+	if !ok {
+		return
+	}
+	if !sub.Confirmed {
+		respondError(w, http.StatusForbidden, "Digest email address is not confirmed")
+		return
+	}
+	if !claimDigestEmail(w, r, sub.UserId) {
+		return
+	}
+
+	d, err := digest.Build(r.Context(), *sub, time.Now())
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Sending digest on request", "user", sub.UserId, "frequency", sub.Frequency)
+
+	// sent on request, so the scheduled digest still goes out
+	if err := digest.Send(DigestConfig, sub.Email, d); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to send digest", "user", sub.UserId, "error", err)
+		respondError(w, http.StatusBadGateway, "Failed to send digest")
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Digest sent successfully"})
+}
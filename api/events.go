@@ -0,0 +1,111 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/events"
+	"barrettotte/questlines/models"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// header clients send to recognize their own changes in event streams
+const ClientIdHeader = "X-Client-Id"
+
+// comment sent periodically so proxies don't close idle streams
+const eventStreamHeartbeat = 25 * time.Second
+
+// publishChanges publishes the difference between two versions of a questline to subscribers
+func publishChanges(r *http.Request, before *models.Questline, after *models.Questline) {
+	changes := events.Diff(before, after)
+	if len(changes) == 0 {
+		return
+	}
+
+	userId := ""
+	if user := auth.UserFrom(r.Context()); user != nil {
+		userId = user.Id
+	}
+	for i := range changes {
+		changes[i].UserId = userId
+		changes[i].Origin = r.Header.Get(ClientIdHeader)
+	}
+	events.Publish(changes...)
+}
+
+// helper for completing or reopening quests broken down into a changed questline, publishing their changes.
+// The questline itself is already saved, so failures are only logged
+func updateParentQuests(r *http.Request, questlineId string) {
+	changes, err := db.UpdateParentQuests(r.Context(), questlineId)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update parent quests", "questline", questlineId, "error", err)
+	}
+	for _, c := range changes {
+		publishChanges(r, c.Before, c.After)
+	}
+}
+
+// QuestlineEventsHandler handles GET /api/questlines/{id}/events
+func QuestlineEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+
+	changes, unsubscribe := events.Subscribe(id)
+	defer unsubscribe()
+
+	slog.InfoContext(r.Context(), "Streaming events", "questline", id)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			slog.InfoContext(r.Context(), "Stopped streaming events", "questline", id)
+			return
+
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+
+		case e, ok := <-changes:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "Failed to marshal event", "event", e.Id, "error", err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %s\ndata: %s\n\n", e.Id, data)
+			flusher.Flush()
+
+			// nothing left to stream
+			if e.Type == events.QuestlineDeleted {
+				return
+			}
+		}
+	}
+}
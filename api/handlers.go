@@ -1,16 +1,30 @@
 package api
 
 import (
+	"barrettotte/questlines/auth"
 	"barrettotte/questlines/db"
+	"barrettotte/questlines/logging"
 	"barrettotte/questlines/models"
-	"database/sql"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi"
 )
 
+// Message is the response of requests that only need to confirm they succeeded
+type Message struct {
+	Message string `json:"message"`
+}
+
+func (m Message) String() string {
+	return fmt.Sprintf("Message{Message: '%v'}", m.Message)
+}
+
 type HealthStatus struct {
 	Api bool `json:"api"`
 	Db  bool `json:"db"`
@@ -20,7 +34,7 @@ type HealthStatus struct {
 func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
 	resp, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %v", err)
+		logging.SetError(w, fmt.Sprintf("failed to marshal JSON: %v", err))
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte(err.Error()))
 		return
@@ -30,10 +44,76 @@ func respondJSON(w http.ResponseWriter, status int, payload interface{}) {
 	w.Write(resp)
 }
 
-// helper for sending error responses
-func respondError(w http.ResponseWriter, code int, msg string) {
-	log.Printf("error: %s", msg)
-	respondJSON(w, code, map[string]string{"error": msg})
+// limit of request bodies, questlines are the largest payloads
+const maxBodyBytes = 1 << 20
+
+// helper for decoding json request bodies, responds with an error if the body is too large, malformed or has unknown fields
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	defer r.Body.Close()
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		respondDecodeError(w, err)
+		return false
+	}
+	if decoder.More() {
+		respondError(w, http.StatusBadRequest, "Request body must be a single JSON value")
+		return false
+	}
+	return true
+}
+
+// helper for sending error responses for json that can't be decoded
+func respondDecodeError(w http.ResponseWriter, err error) {
+	respondRequestError(w, decodeError(err))
+}
+
+// helper for describing why json can't be decoded as a request error
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return newRequestError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must be at most %d bytes", maxBytesErr.Limit))
+	case errors.As(err, &typeErr):
+		return invalidError([]models.FieldError{{Field: typeErr.Field, Message: "must be " + typeErr.Type.String()}})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return invalidError([]models.FieldError{{Field: field, Message: "is not a known field"}})
+	default:
+		return newRequestError(http.StatusBadRequest, "Invalid request payload")
+	}
+}
+
+// helper for validating a questline, responds with field errors if it is invalid
+func validateQuestline(w http.ResponseWriter, ql *models.Questline) bool {
+	if err := checkQuestline(ql); err != nil {
+		respondRequestError(w, err)
+		return false
+	}
+	return true
+}
+
+// helper for validating a questline, returns a request error with its field errors if it is invalid
+func checkQuestline(ql *models.Questline) error {
+	if errs := ql.Validate(); len(errs) > 0 {
+		return invalidError(errs)
+	}
+	return nil
+}
+
+// helper for parsing optional boolean query params
+func parseBoolParam(r *http.Request, name string, fallback bool) (bool, error) {
+	param := r.URL.Query().Get(name)
+	if param == "" {
+		return fallback, nil
+	}
+	return strconv.ParseBool(param)
 }
 
 // UpHandler handles GET /api/up for health status
@@ -42,21 +122,23 @@ func UpHandler(w http.ResponseWriter, r *http.Request) {
 
 	if db.DB != nil {
 		if err := db.DB.Ping(); err != nil {
-			log.Printf("WARN: Health check DB ping failed: %v", err)
+			slog.WarnContext(r.Context(), "Health check DB ping failed", "error", err)
 		} else {
 			status.Db = true
 		}
 	} else {
-		log.Printf("WARN: Health check found DB is nil")
+		slog.WarnContext(r.Context(), "Health check found DB is nil")
 	}
 	respondJSON(w, http.StatusOK, status)
 }
 
 // GetQuestlinesHandler handles GET /api/questlines
 func GetQuestlinesHandler(w http.ResponseWriter, r *http.Request) {
-	infos, err := db.GetQuestlineInfos()
+	user := auth.UserFrom(r.Context())
+
+	infos, err := db.GetQuestlineInfos(r.Context(), user.Id)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondDbError(w, err)
 		return
 	}
 	respondJSON(w, http.StatusOK, infos)
@@ -66,34 +148,40 @@ func GetQuestlinesHandler(w http.ResponseWriter, r *http.Request) {
 func CreateQuestlineHandler(w http.ResponseWriter, r *http.Request) {
 	var toCreate models.Questline
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&toCreate); err != nil {
-		log.Printf("Bad payload: %s", r.Body)
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	if !decodeJSON(w, r, &toCreate) {
 		return
 	}
-	defer r.Body.Close()
 
-	log.Printf("Creating questline\n%v", toCreate)
+	slog.InfoContext(r.Context(), "Creating questline", "name", toCreate.Name, "quests", len(toCreate.Quests))
+	logging.Payload(r.Context(), "Questline to create", toCreate)
 
-	created, err := db.CreateQuestline(&toCreate)
+	if !validateQuestline(w, &toCreate) || !authorizeExternalDependencies(w, r, &toCreate) || !authorizeChildQuestlines(w, r, &toCreate, nil) {
+		return
+	}
+	toCreate.OwnerId = auth.UserFrom(r.Context()).Id
+
+	created, err := db.CreateQuestline(r.Context(), &toCreate)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondDbError(w, err)
 		return
 	}
+	publishChanges(r, nil, created)
 	respondJSON(w, http.StatusCreated, created)
 }
 
 // GetQuestlineHandler handles GET /api/questlines/{id}
 func GetQuestlineHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
 
-	ql, err := db.GetQuestline(id)
+	ql, err := db.GetQuestline(r.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, db.ErrNotFound) {
 			respondError(w, http.StatusNotFound, "Questline not found")
 		} else {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondDbError(w, err)
 		}
 		return
 	}
@@ -105,61 +193,89 @@ func UpdateQuestlineHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	var toUpdate models.Questline
 
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&toUpdate); err != nil {
-		log.Printf("Bad payload: %s", r.Body)
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
+	if !decodeJSON(w, r, &toUpdate) {
 		return
 	}
-	defer r.Body.Close()
 
-	log.Printf("Updating questline %s to\n%v", toUpdate.Id, toUpdate)
+	slog.InfoContext(r.Context(), "Updating questline", "questline", toUpdate.Id, "quests", len(toUpdate.Quests))
+	logging.Payload(r.Context(), "Questline to update", toUpdate)
 
 	if toUpdate.Id != id {
 		respondError(w, http.StatusBadRequest, "ID mismatch between URL param and body")
 		return
 	}
+	if !validateQuestline(w, &toUpdate) || !authorizeQuestline(w, r, id, models.RoleEditor) || !authorizeExternalDependencies(w, r, &toUpdate) {
+		return
+	}
 
-	updated, err := db.UpdateQuestline(&toUpdate)
+	before, err := db.GetQuestline(r.Context(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		respondDbError(w, err)
+		return
+	}
+	if !authorizeChildQuestlines(w, r, &toUpdate, before) {
+		return
+	}
+
+	updated, err := db.UpdateQuestline(r.Context(), &toUpdate)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
 			respondError(w, http.StatusNotFound, "Questline not found")
 		} else {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondDbError(w, err)
 		}
 		return
 	}
+	publishChanges(r, before, updated)
+	updateParentQuests(r, id)
 	respondJSON(w, http.StatusOK, updated)
 }
 
 // DeleteQuestlineHandler handles DELETE /api/questlines/{id}
 func DeleteQuestlineHandler(w http.ResponseWriter, r *http.Request) {
 	toDelete := chi.URLParam(r, "id")
-	log.Printf("Deleting questline %s", toDelete)
+	if !authorizeQuestline(w, r, toDelete, models.RoleOwner) {
+		return
+	}
+	slog.InfoContext(r.Context(), "Deleting questline", "questline", toDelete)
 
-	err := db.DeleteQuestline(toDelete)
+	before, err := db.GetQuestline(r.Context(), toDelete)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, err.Error())
+		respondDbError(w, err)
 		return
 	}
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Questline deleted successfully"})
+
+	if err := db.DeleteQuestline(r.Context(), toDelete); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	publishChanges(r, before, nil)
+	updateParentQuests(r, toDelete)
+	respondJSON(w, http.StatusOK, Message{Message: "Questline moved to trash"})
 }
 
 // ExportQuestlineHandler handles GET /api/questlines/{id}/export
 func ExportQuestlineHandler(w http.ResponseWriter, r *http.Request) {
 	toExportId := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, toExportId, models.RoleViewer) {
+		return
+	}
 
 	fmt := r.URL.Query().Get("fmt")
 	if fmt == "" {
 		fmt = "json" // default
 	}
 
-	toExport, err := db.GetQuestline(toExportId)
+	toExport, err := db.GetQuestline(r.Context(), toExportId)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, db.ErrNotFound) {
 			respondError(w, http.StatusNotFound, "Questline not found")
 		} else {
-			respondError(w, http.StatusInternalServerError, err.Error())
+			respondDbError(w, err)
 		}
 		return
 	}
@@ -168,7 +284,7 @@ func ExportQuestlineHandler(w http.ResponseWriter, r *http.Request) {
 	contentType := ""
 	fileName := toExport.Name + "." + fmt
 
-	log.Printf("Exporting questline %s to %s", toExportId, fileName)
+	slog.InfoContext(r.Context(), "Exporting questline", "questline", toExportId, "file", fileName)
 
 	switch fmt {
 	case "json":
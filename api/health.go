@@ -0,0 +1,131 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/version"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	HealthOk          = "ok"
+	HealthUnavailable = "unavailable"
+
+	// time allowed for all readiness checks
+	readinessTimeout = 5 * time.Second
+)
+
+var started = time.Now()
+
+type HealthCheck struct {
+	Ok        bool   `json:"ok"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (c HealthCheck) String() string {
+	return fmt.Sprintf("HealthCheck{Ok: %v, LatencyMs: %d, Error: '%v'}", c.Ok, c.LatencyMs, c.Error)
+}
+
+type Liveness struct {
+	Status string       `json:"status"`
+	Uptime string       `json:"uptime"`
+	Build  version.Info `json:"build"`
+}
+
+func (l Liveness) String() string {
+	return fmt.Sprintf("Liveness{Status: '%v', Uptime: '%v', Build: %v}", l.Status, l.Uptime, l.Build)
+}
+
+type Readiness struct {
+	Status      string                 `json:"status"`
+	Uptime      string                 `json:"uptime"`
+	Build       version.Info           `json:"build"`
+	Migrations  *db.MigrationStatus    `json:"migrations,omitempty"`
+	DbSizeBytes int64                  `json:"dbSizeBytes"`
+	Checks      map[string]HealthCheck `json:"checks"`
+}
+
+func (r Readiness) String() string {
+	return fmt.Sprintf("Readiness{Status: '%v', Migrations: %v, DbSizeBytes: %d, Checks: %v}",
+		r.Status, r.Migrations, r.DbSizeBytes, r.Checks,
+	)
+}
+
+// helper for timing a single readiness check
+func runCheck(check func() error) HealthCheck {
+	start := time.Now()
+	err := check()
+
+	result := HealthCheck{Ok: err == nil, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// LivenessHandler handles GET /api/health/live, the process is up without checking dependencies
+func LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	respondJSON(w, http.StatusOK, Liveness{
+		Status: HealthOk,
+		Uptime: time.Since(started).Round(time.Second).String(),
+		Build:  version.Get(),
+	})
+}
+
+// ReadinessHandler handles GET /api/health/ready, responding 503 if any check fails
+func ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	ready := Readiness{
+		Status: HealthOk,
+		Uptime: time.Since(started).Round(time.Second).String(),
+		Build:  version.Get(),
+		Checks: make(map[string]HealthCheck),
+	}
+
+	if db.DB == nil {
+		ready.Checks["database"] = HealthCheck{Error: "database is not initialized"}
+	} else {
+		ready.Checks["database"] = runCheck(func() error {
+			return db.DB.PingContext(ctx)
+		})
+		ready.Checks["migrations"] = runCheck(func() error {
+			status, err := db.GetMigrationStatus(ctx)
+			if err != nil {
+				return err
+			}
+			ready.Migrations = status
+
+			if status.Dirty {
+				return fmt.Errorf("migration %d failed part way and needs fixing by hand", status.Version)
+			}
+			if status.Version < status.Latest {
+				return fmt.Errorf("migration %d applied but %d is the latest", status.Version, status.Latest)
+			}
+			return nil
+		})
+		ready.Checks["writable"] = runCheck(func() error {
+			return db.CheckWritable(ctx)
+		})
+		ready.Checks["dbFile"] = runCheck(func() error {
+			size, err := db.GetFileSize()
+			ready.DbSizeBytes = size
+			return err
+		})
+	}
+
+	status := http.StatusOK
+	for name, check := range ready.Checks {
+		if !check.Ok {
+			slog.WarnContext(r.Context(), "Readiness check failed", "check", name, "error", check.Error)
+			ready.Status = HealthUnavailable
+			status = http.StatusServiceUnavailable
+		}
+	}
+	respondJSON(w, status, ready)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/graph"
+	"barrettotte/questlines/models"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi"
+)
+
+// LayoutQuestlineHandler handles POST /api/questlines/{id}/layout
+func LayoutQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleEditor) {
+		return
+	}
+
+	algo := r.URL.Query().Get("algo")
+	if algo == "" {
+		algo = graph.LayoutLayered // default
+	}
+	direction := r.URL.Query().Get("dir")
+	if direction == "" {
+		direction = graph.DirectionLeftRight // default
+	}
+
+	ql, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Laying out questline", "questline", id, "algorithm", algo, "direction", direction)
+
+	before := *ql
+	before.Quests = slices.Clone(ql.Quests) // layout moves quests in place
+
+	if err := graph.Layout(ql, algo, direction); err != nil {
+		switch {
+		case errors.Is(err, graph.ErrUnknownLayout), errors.Is(err, graph.ErrUnknownDirection):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, graph.ErrCycle):
+			respondError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	if err := db.UpdateQuestPositions(r.Context(), id, ql.Quests); err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	updated, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	publishChanges(r, &before, updated)
+	respondJSON(w, http.StatusOK, updated)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/metrics"
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	questlinesDesc     = prometheus.NewDesc("questlines_questlines", "Number of questlines.", nil, nil)
+	questsDesc         = prometheus.NewDesc("questlines_quests", "Number of quests across all questlines.", nil, nil)
+	completedRatioDesc = prometheus.NewDesc("questlines_quests_completion_ratio", "Ratio of completed quests across all questlines.", nil, nil)
+)
+
+// statsCollector collects gauges of totals from the database, queried once per scrape
+type statsCollector struct{}
+
+func (statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- questlinesDesc
+	ch <- questsDesc
+	ch <- completedRatioDesc
+}
+
+func (statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := db.GetStats(context.Background())
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(questlinesDesc, err)
+		return
+	}
+
+	ratio := 0.0
+	if stats.Quests > 0 {
+		ratio = float64(stats.CompletedQuests) / float64(stats.Quests)
+	}
+	ch <- prometheus.MustNewConstMetric(questlinesDesc, prometheus.GaugeValue, float64(stats.Questlines))
+	ch <- prometheus.MustNewConstMetric(questsDesc, prometheus.GaugeValue, float64(stats.Quests))
+	ch <- prometheus.MustNewConstMetric(completedRatioDesc, prometheus.GaugeValue, ratio)
+}
+
+// RegisterMetrics registers gauges computed from the database on each scrape
+func RegisterMetrics() {
+	metrics.Registry.MustRegister(statsCollector{})
+}
@@ -0,0 +1,270 @@
+package api
+
+import (
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/openapi"
+	"barrettotte/questlines/patch"
+	"barrettotte/questlines/version"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	jsonContentType     = "application/json"
+	calendarContentType = "text/calendar"
+)
+
+// describes a route in the OpenAPI document, path params and authentication come from the router
+type operation struct {
+	summary     string
+	tag         string
+	query       []openapi.Parameter
+	body        any            // json request body, nil if none
+	bodies      map[string]any // request bodies by content type, for other content types than json
+	status      int            // success status, 200 if zero
+	response    any            // success response, Message if nil
+	contentType string         // success content type, json if empty
+}
+
+// helper for describing query params
+func queryParam(name string, typ string, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: &openapi.Schema{Type: typ}}
+}
+
+// operations by method and path relative to /api, keep in sync when adding routes
+var operations = map[string]operation{
+	// auth
+	"POST /auth/register": {summary: "Register a user and start a session", tag: "auth", body: Credentials{}, status: http.StatusCreated, response: SessionInfo{}},
+	"POST /auth/login":    {summary: "Start a session", tag: "auth", body: Credentials{}, response: SessionInfo{}},
+	"POST /auth/logout":   {summary: "End the current session", tag: "auth"},
+	"GET /auth/me":        {summary: "Get the current user", tag: "auth", response: models.User{}},
+
+	// public
+	"GET /public/{token}": {summary: "Get a questline through a share link", tag: "shares", response: models.Questline{}},
+
+	// misc
+	"GET /up":                       {summary: "Check API and database are up", tag: "health", response: HealthStatus{}},
+	"GET /health/live":              {summary: "Check the server is running", tag: "health", response: Liveness{}},
+	"GET /health/ready":             {summary: "Check the server can handle requests", tag: "health", response: Readiness{}},
+	"GET /openapi.json":             {summary: "Get this OpenAPI document", tag: "health", response: map[string]any{}},
+	"GET /next":                     {summary: "Get quests available across all questlines", tag: "questlines", query: []openapi.Parameter{queryParam("limit", "integer", "Maximum quests, all if zero")}, response: []models.AvailableQuest{}},
+	"POST /batch":                   {summary: "Apply changes across questlines in one transaction, all or nothing", tag: "questlines", body: models.BatchRequest{}, response: models.BatchResponse{}},
+	"GET /calendar.ics":             {summary: "Get calendar feed of all questlines", tag: "calendar", query: []openapi.Parameter{queryParam("events", "boolean", "Use all-day events instead of tasks"), queryParam("token", "string", "Read-only API token for calendar apps")}, response: "", contentType: calendarContentType},
+	"GET /trash":                    {summary: "List questlines and quests in the trash", tag: "trash", response: []models.TrashItem{}},
+	"GET /questlines":               {summary: "List questlines owned by or shared with the current user", tag: "questlines", response: []models.QuestlineInfo{}},
+	"POST /questlines":              {summary: "Create a questline", tag: "questlines", body: models.Questline{}, status: http.StatusCreated, response: models.Questline{}},
+	"GET /templates":                {summary: "List templates", tag: "templates", response: []models.TemplateInfo{}},
+	"POST /templates":               {summary: "Create a template", tag: "templates", body: models.Template{}, status: http.StatusCreated, response: models.Template{}},
+	"GET /tokens":                   {summary: "List API tokens of the current user", tag: "tokens", response: []models.ApiToken{}},
+	"POST /tokens":                  {summary: "Create an API token, returned once", tag: "tokens", body: ApiTokenRequest{}, status: http.StatusCreated, response: models.ApiToken{}},
+	"GET /digest":                   {summary: "Get digest subscription of the current user", tag: "digests", response: models.DigestSubscription{}},
+	"PUT /digest":                   {summary: "Subscribe to digest emails, a new address is emailed a confirmation code", tag: "digests", body: DigestRequest{}, response: models.DigestSubscription{}},
+	"DELETE /digest":                {summary: "Unsubscribe from digest emails", tag: "digests"},
+	"POST /digest/confirm":          {summary: "Confirm digest email address with the emailed code", tag: "digests", body: DigestConfirmRequest{}, response: models.DigestSubscription{}},
+	"POST /digest/send":             {summary: "Send digest now, at most once every few minutes", tag: "digests"},
+	"GET /webhooks":                 {summary: "List webhooks of the current user", tag: "webhooks", response: []models.Webhook{}},
+	"POST /webhooks":                {summary: "Create a webhook, its secret is returned once", tag: "webhooks", body: WebhookRequest{}, status: http.StatusCreated, response: models.Webhook{}},
+	"GET /webhooks/{id}":            {summary: "Get a webhook", tag: "webhooks", response: models.Webhook{}},
+	"DELETE /webhooks/{id}":         {summary: "Delete a webhook", tag: "webhooks"},
+	"GET /webhooks/{id}/deliveries": {summary: "List recent deliveries of a webhook", tag: "webhooks", response: []models.WebhookDelivery{}},
+	"POST /webhooks/{id}/test":      {summary: "Deliver a ping event to a webhook", tag: "webhooks", response: models.WebhookDelivery{}},
+	"GET /digest/preview": {
+		summary: "Render digest without sending it", tag: "digests",
+		query:    []openapi.Parameter{queryParam("format", "string", "html or text")},
+		response: "", contentType: "text/plain",
+	},
+
+	// trash
+	"POST /trash/questlines/{id}/restore": {summary: "Restore a questline from the trash", tag: "trash", response: models.Questline{}},
+	"DELETE /trash/questlines/{id}":       {summary: "Permanently delete a questline in the trash", tag: "trash"},
+	"POST /trash/quests/{id}/restore":     {summary: "Restore a quest and its dependencies from the trash", tag: "trash", response: models.Questline{}},
+	"DELETE /trash/quests/{id}":           {summary: "Permanently delete a quest in the trash", tag: "trash"},
+
+	// questline
+	"GET /questlines/{id}": {summary: "Get a questline", tag: "questlines", response: models.Questline{}},
+	"PUT /questlines/{id}": {summary: "Replace a questline", tag: "questlines", body: models.Questline{}, response: models.Questline{}},
+	"PATCH /questlines/{id}": {
+		summary: "Change part of a questline with a JSON Patch or JSON Merge Patch", tag: "questlines",
+		bodies:   map[string]any{patch.JsonPatchContentType: []patch.Operation{}, patch.MergePatchContentType: map[string]any{}},
+		response: models.Questline{},
+	},
+	"DELETE /questlines/{id}": {summary: "Move a questline to the trash", tag: "questlines"},
+	"GET /questlines/{id}/export": {
+		summary: "Download a questline", tag: "questlines",
+		query:    []openapi.Parameter{queryParam("fmt", "string", "Export format, only json")},
+		response: models.Questline{},
+	},
+	"GET /questlines/{id}/events":                           {summary: "Stream changes of a questline as server-sent events", tag: "questlines", response: "", contentType: "text/event-stream"},
+	"GET /questlines/{id}/calendar.ics":                     {summary: "Get calendar feed of a questline", tag: "calendar", query: []openapi.Parameter{queryParam("events", "boolean", "Use all-day events instead of tasks"), queryParam("token", "string", "Read-only API token for calendar apps")}, response: "", contentType: calendarContentType},
+	"GET /questlines/{id}/available":                        {summary: "Get quests whose prerequisites are completed", tag: "questlines", response: []models.AvailableQuest{}},
+	"GET /questlines/{id}/analysis":                         {summary: "Get critical path and progress of a questline", tag: "questlines", query: []openapi.Parameter{queryParam("weighted", "boolean", "Weight quests by effort")}, response: models.QuestlineAnalysis{}},
+	"GET /questlines/{id}/objectives/{objectiveId}/history": {summary: "Get completion history of a recurring objective", tag: "questlines", response: []models.ObjectiveCompletion{}},
+	"POST /questlines/{id}/layout": {
+		summary: "Arrange quests of a questline automatically", tag: "questlines",
+		query:    []openapi.Parameter{queryParam("algo", "string", "Layout algorithm"), queryParam("dir", "string", "Layout direction")},
+		response: models.Questline{},
+	},
+	"POST /questlines/{id}/sync": {summary: "Merge changes made offline into a questline", tag: "questlines", body: SyncRequest{}, response: SyncResponse{}},
+	"POST /questlines/{id}/clone": {
+		summary: "Copy a questline", tag: "questlines",
+		query:  []openapi.Parameter{queryParam("name", "string", "Name of copy"), queryParam("reset", "boolean", "Reset progress of copy")},
+		status: http.StatusCreated, response: models.Questline{},
+	},
+	"POST /questlines/{id}/template": {
+		summary: "Create a template from a questline", tag: "templates",
+		query:  []openapi.Parameter{queryParam("name", "string", "Name of template"), queryParam("description", "string", "Description of template")},
+		status: http.StatusCreated, response: models.Template{},
+	},
+	"GET /questlines/{id}/permissions":             {summary: "List users a questline is shared with", tag: "permissions", response: []models.Permission{}},
+	"PUT /questlines/{id}/permissions":             {summary: "Share a questline with a user", tag: "permissions", body: ShareRequest{}, response: []models.Permission{}},
+	"DELETE /questlines/{id}/permissions/{userId}": {summary: "Stop sharing a questline with a user", tag: "permissions"},
+	"POST /questlines/{id}/share":                  {summary: "Create a public read-only link, its token is returned once", tag: "shares", body: ShareLinkRequest{}, status: http.StatusCreated, response: models.ShareLink{}},
+	"GET /questlines/{id}/shares":                  {summary: "List share links of a questline", tag: "shares", response: []models.ShareLink{}},
+	"DELETE /questlines/{id}/shares/{shareId}":     {summary: "Revoke a share link", tag: "shares"},
+
+	// template
+	"GET /templates/{id}":    {summary: "Get a template", tag: "templates", response: models.Template{}},
+	"DELETE /templates/{id}": {summary: "Delete a template you own", tag: "templates"},
+	"POST /templates/{id}/instantiate": {
+		summary: "Create a questline from a template", tag: "templates",
+		query:  []openapi.Parameter{queryParam("name", "string", "Name of questline")},
+		status: http.StatusCreated, response: models.Questline{},
+	},
+
+	// tokens
+	"DELETE /tokens/{id}": {summary: "Revoke an API token", tag: "tokens"},
+}
+
+var (
+	pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+	closurePattern   = regexp.MustCompile(`(\.(func)?\d+)+$`) // handlers returned by functions like OpenApiHandler
+)
+
+// helper for naming operations after their handler, GetQuestlineHandler becomes getQuestline
+func operationId(handler http.Handler) string {
+	name := closurePattern.ReplaceAllString(runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name(), "")
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "Handler")
+	if name == "" {
+		return ""
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// helper for checking a route requires authentication
+func requiresAuth(middlewares []func(http.Handler) http.Handler) bool {
+	authenticate := reflect.ValueOf(Authenticate).Pointer()
+	for _, mw := range middlewares {
+		if reflect.ValueOf(mw).Pointer() == authenticate {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildOpenApi describes the routes of the API router, routes missing from operations are still listed
+func BuildOpenApi(routes chi.Routes, serverUrl string) (*openapi.Document, error) {
+	doc := openapi.New(openapi.Info{
+		Title:       "Questlines API",
+		Description: "Errors are RFC 7807 problem details.",
+		Version:     version.Get().Version,
+	}, serverUrl)
+	doc.Components.SecuritySchemes["bearer"] = openapi.SecurityScheme{Type: "http", Scheme: "bearer"}
+	doc.Components.SecuritySchemes["cookie"] = openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: sessionCookieName}
+
+	problem := map[string]openapi.MediaType{problemContentType: {Schema: doc.SchemaOf(Problem{})}}
+
+	err := chi.Walk(routes, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		if route == "" || strings.Contains(route, "*") {
+			return nil
+		}
+
+		op, documented := operations[method+" "+route]
+		if !documented {
+			slog.Warn("Route is missing from OpenAPI operations", "method", method, "route", route)
+		}
+
+		status := op.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		contentType := op.contentType
+		if contentType == "" {
+			contentType = jsonContentType
+		}
+		response := op.response
+		if response == nil {
+			response = Message{}
+		}
+
+		result := &openapi.Operation{
+			OperationId: operationId(handler),
+			Summary:     op.summary,
+			Responses: map[string]openapi.Response{
+				strconv.Itoa(status): {
+					Description: http.StatusText(status),
+					Content:     map[string]openapi.MediaType{contentType: {Schema: doc.SchemaOf(response)}},
+				},
+				"default": {Description: "Problem", Content: problem},
+			},
+			Security: []map[string][]string{},
+		}
+		if op.tag != "" {
+			result.Tags = []string{op.tag}
+		}
+
+		for _, match := range pathParamPattern.FindAllStringSubmatch(route, -1) {
+			result.Parameters = append(result.Parameters, openapi.Parameter{
+				Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"},
+			})
+		}
+		result.Parameters = append(result.Parameters, op.query...)
+
+		if op.body != nil || len(op.bodies) > 0 {
+			result.RequestBody = &openapi.RequestBody{Required: true, Content: make(map[string]openapi.MediaType)}
+			if op.body != nil {
+				result.RequestBody.Content[jsonContentType] = openapi.MediaType{Schema: doc.SchemaOf(op.body)}
+			}
+			for contentType, body := range op.bodies {
+				result.RequestBody.Content[contentType] = openapi.MediaType{Schema: doc.SchemaOf(body)}
+			}
+		}
+		if requiresAuth(middlewares) {
+			result.Security = []map[string][]string{{"bearer": {}}, {"cookie": {}}}
+		}
+
+		doc.AddOperation(method, route, result)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk routes: %w", err)
+	}
+	return doc, nil
+}
+
+// OpenApiHandler serves the OpenAPI document of the API router, built on first request once all routes are registered
+func OpenApiHandler(routes chi.Routes, serverUrl string) http.HandlerFunc {
+	var once sync.Once
+	var doc *openapi.Document
+	var buildErr error
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			doc, buildErr = BuildOpenApi(routes, serverUrl)
+		})
+		if buildErr != nil {
+			respondDbError(w, buildErr)
+			return
+		}
+		respondJSON(w, http.StatusOK, doc)
+	}
+}
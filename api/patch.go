@@ -0,0 +1,113 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/logging"
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/patch"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// PatchQuestlineHandler handles PATCH /api/questlines/{id} with a JSON Patch or JSON Merge Patch
+func PatchQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var apply func(doc []byte) ([]byte, error)
+
+	switch contentType {
+	case patch.JsonPatchContentType:
+		var ops []patch.Operation
+		if !decodeJSON(w, r, &ops) {
+			return
+		}
+		slog.InfoContext(r.Context(), "Patching questline", "questline", id, "format", "json-patch", "operations", len(ops))
+		logging.Payload(r.Context(), "Questline patch", ops)
+
+		apply = func(doc []byte) ([]byte, error) {
+			return patch.Apply(doc, ops)
+		}
+	case patch.MergePatchContentType:
+		var mergePatch json.RawMessage
+		if !decodeJSON(w, r, &mergePatch) {
+			return
+		}
+		if !bytes.HasPrefix(bytes.TrimSpace(mergePatch), []byte("{")) {
+			respondError(w, http.StatusBadRequest, "Merge patch must be a JSON object")
+			return
+		}
+		slog.InfoContext(r.Context(), "Patching questline", "questline", id, "format", "merge-patch")
+		logging.Payload(r.Context(), "Questline patch", mergePatch)
+
+		apply = func(doc []byte) ([]byte, error) {
+			return patch.Merge(doc, mergePatch)
+		}
+	default:
+		w.Header().Set("Accept-Patch", patch.JsonPatchContentType+", "+patch.MergePatchContentType)
+		respondError(w, http.StatusUnsupportedMediaType,
+			fmt.Sprintf("Content-Type must be %s or %s", patch.JsonPatchContentType, patch.MergePatchContentType),
+		)
+		return
+	}
+
+	if !authorizeQuestline(w, r, id, models.RoleEditor) {
+		return
+	}
+
+	// patch is applied to the stored questline inside the transaction saving it, responses are only sent once it is over
+	before, updated, err := db.PatchQuestline(r.Context(), id, func(before *models.Questline) (*models.Questline, error) {
+		doc, err := json.Marshal(before)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal questline %s: %w", id, err)
+		}
+
+		patched, err := apply(doc)
+		if err != nil {
+			switch {
+			case errors.Is(err, patch.ErrTestFailed):
+				return nil, newRequestError(http.StatusConflict, err.Error())
+			case errors.Is(err, patch.ErrInvalidPatch):
+				return nil, newRequestError(http.StatusBadRequest, err.Error())
+			default:
+				return nil, err
+			}
+		}
+
+		var ql models.Questline
+		decoder := json.NewDecoder(bytes.NewReader(patched))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&ql); err != nil {
+			return nil, decodeError(err)
+		}
+
+		if ql.Id != id {
+			return nil, newRequestError(http.StatusBadRequest, "Patch may not change the questline ID")
+		}
+		if err := checkQuestline(&ql); err != nil {
+			return nil, err
+		}
+		if err := checkExternalDependencies(r, &ql); err != nil {
+			return nil, err
+		}
+		if err := checkChildQuestlines(r, &ql, before); err != nil {
+			return nil, err
+		}
+		return &ql, nil
+	})
+	if err != nil {
+		respondRequestError(w, err)
+		return
+	}
+
+	publishChanges(r, before, updated)
+	updateParentQuests(r, id)
+	respondJSON(w, http.StatusOK, updated)
+}
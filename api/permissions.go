@@ -0,0 +1,107 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+type ShareRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// GetQuestlinePermissionsHandler handles GET /api/questlines/{id}/permissions
+func GetQuestlinePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
+
+	permissions, err := db.GetQuestlinePermissions(r.Context(), id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, permissions)
+}
+
+// ShareQuestlineHandler handles PUT /api/questlines/{id}/permissions
+func ShareQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleOwner) {
+		return
+	}
+
+	var toShare ShareRequest
+	if !decodeJSON(w, r, &toShare) {
+		return
+	}
+
+	if !models.IsValidRole(toShare.Role) {
+		respondError(w, http.StatusBadRequest, "Role must be one of viewer, editor, or owner")
+		return
+	}
+
+	user, err := db.GetUserByUsername(r.Context(), toShare.Username)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "User not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	ql, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	if ql.OwnerId == user.Id {
+		respondError(w, http.StatusBadRequest, "Cannot change role of questline creator")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Sharing questline", "questline", id, "user", user.Id, "role", toShare.Role)
+
+	if err := db.SetQuestlinePermission(r.Context(), id, user.Id, toShare.Role); err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	permissions, err := db.GetQuestlinePermissions(r.Context(), id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, permissions)
+}
+
+// UnshareQuestlineHandler handles DELETE /api/questlines/{id}/permissions/{userId}
+func UnshareQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	userId := chi.URLParam(r, "userId")
+
+	// users can always leave a questline shared with them
+	required := models.RoleOwner
+	if userId == auth.UserFrom(r.Context()).Id {
+		required = models.RoleViewer
+	}
+	if !authorizeQuestline(w, r, id, required) {
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Unsharing questline", "questline", id, "user", userId)
+
+	if err := db.DeleteQuestlinePermission(r.Context(), id, userId); err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Questline unshared successfully"})
+}
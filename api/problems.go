@@ -0,0 +1,133 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/logging"
+	"barrettotte/questlines/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const problemContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response, sent for every error
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	RequestId string              `json:"requestId,omitempty"`
+	Errors    []models.FieldError `json:"errors,omitempty"` // invalid fields of request
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("Problem{Type: %s, Status: %d, Detail: %s}", p.Type, p.Status, p.Detail)
+}
+
+// helper for sending problem responses
+func respondProblem(w http.ResponseWriter, problem Problem) {
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	problem.RequestId = w.Header().Get(logging.RequestIdHeader)
+
+	resp, err := json.Marshal(problem)
+	if err != nil {
+		logging.SetError(w, fmt.Sprintf("failed to marshal problem: %v", err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(resp)
+}
+
+// helper for sending error responses
+func respondError(w http.ResponseWriter, code int, msg string) {
+	logging.SetError(w, msg)
+	respondProblem(w, Problem{Status: code, Detail: msg})
+}
+
+// helper for sending field errors of an invalid request
+func respondInvalid(w http.ResponseWriter, errs []models.FieldError) {
+	respondRequestError(w, invalidError(errs))
+}
+
+// requestError is a problem with a request found where no response can be sent yet, like inside a db transaction
+type requestError struct {
+	Problem
+}
+
+func (e *requestError) Error() string {
+	return e.Detail
+}
+
+// helper for creating a request error responded with a status
+func newRequestError(status int, detail string) error {
+	return &requestError{Problem{Status: status, Detail: detail}}
+}
+
+// helper for creating a request error with the field errors of an invalid request
+func invalidError(errs []models.FieldError) error {
+	return &requestError{Problem{Status: http.StatusBadRequest, Detail: fmt.Sprintf("%d invalid field(s)", len(errs)), Errors: errs}}
+}
+
+// helper for sending error responses for request errors, anything else is handled as an error from db
+func respondRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		respondDbError(w, err)
+		return
+	}
+	logging.SetError(w, reqErr.Detail)
+	respondProblem(w, reqErr.Problem)
+}
+
+// helper for sending error responses for errors from db. Only messages of client errors are sent,
+// the rest of the chain may have internal details so it is only logged
+func respondDbError(w http.ResponseWriter, err error) {
+	var invalidErr *db.InvalidError
+	if errors.As(err, &invalidErr) {
+		respondInvalid(w, invalidErr.Errors)
+		return
+	}
+
+	var problem Problem
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		problem = Problem{Status: http.StatusNotFound, Detail: "Resource not found"}
+	case errors.Is(err, db.ErrConflict):
+		problem = Problem{Status: http.StatusConflict, Detail: "Resource conflicts with an existing one"}
+	case errors.Is(err, db.ErrValidation):
+		problem = Problem{Status: http.StatusBadRequest, Detail: "Request is invalid"}
+	default:
+		problem = Problem{Status: http.StatusInternalServerError, Detail: "An unexpected error occurred"}
+	}
+
+	var clientErr *db.ClientError
+	if problem.Status != http.StatusInternalServerError && errors.As(err, &clientErr) {
+		problem.Detail = clientErr.Message
+
+		var batchErr *db.BatchError
+		if errors.As(err, &batchErr) {
+			problem.Detail = fmt.Sprintf("operation %d (%s): %s", batchErr.Index, batchErr.Op, clientErr.Message)
+		}
+	}
+	logging.SetError(w, err.Error())
+	respondProblem(w, problem)
+}
+
+// NotFoundHandler handles API requests to unknown routes
+func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	respondError(w, http.StatusNotFound, fmt.Sprintf("No route for %s", r.URL.Path))
+}
+
+// MethodNotAllowedHandler handles API requests with an unsupported method
+func MethodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	respondError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s not allowed for %s", r.Method, r.URL.Path))
+}
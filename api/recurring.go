@@ -0,0 +1,47 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// GetObjectiveHistoryHandler handles GET /api/questlines/{id}/objectives/{objectiveId}/history
+func GetObjectiveHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	objectiveId := chi.URLParam(r, "objectiveId")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
+
+	ql, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	found := false
+	for _, q := range ql.Quests {
+		for _, o := range q.Objectives {
+			found = found || o.Id == objectiveId
+		}
+	}
+	if !found {
+		respondError(w, http.StatusNotFound, "Objective not found")
+		return
+	}
+
+	completions, err := db.GetObjectiveCompletions(r.Context(), objectiveId)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, completions)
+}
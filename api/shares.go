@@ -0,0 +1,132 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type ShareLinkRequest struct {
+	ExpiresInDays      int  `json:"expiresInDays"` // zero never expires
+	RedactDescriptions bool `json:"redactDescriptions"`
+}
+
+// CreateShareLinkHandler handles POST /api/questlines/{id}/share
+func CreateShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleOwner) {
+		return
+	}
+
+	var toCreate ShareLinkRequest
+	if r.ContentLength != 0 {
+		if !decodeJSON(w, r, &toCreate) {
+			return
+		}
+	}
+
+	if toCreate.ExpiresInDays < 0 {
+		respondError(w, http.StatusBadRequest, "Share link expiry cannot be negative")
+		return
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	link := models.ShareLink{QuestlineId: id, RedactDescriptions: toCreate.RedactDescriptions}
+	if toCreate.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, toCreate.ExpiresInDays)
+		link.Expires = &expires
+	}
+
+	slog.InfoContext(r.Context(), "Creating share link", "questline", id)
+
+	created, err := db.CreateShareLink(r.Context(), &link, auth.HashToken(token))
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	created.Token = token
+	created.Url = "/?share=" + url.QueryEscape(token) // opens frontend in view-only mode
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// GetShareLinksHandler handles GET /api/questlines/{id}/shares
+func GetShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeQuestline(w, r, id, models.RoleOwner) {
+		return
+	}
+
+	links, err := db.GetShareLinks(r.Context(), id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, links)
+}
+
+// DeleteShareLinkHandler handles DELETE /api/questlines/{id}/shares/{shareId}
+func DeleteShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	shareId := chi.URLParam(r, "shareId")
+	if !authorizeQuestline(w, r, id, models.RoleOwner) {
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Revoking share link", "share", shareId, "questline", id)
+
+	if err := db.DeleteShareLink(r.Context(), shareId, id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Share link not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Share link revoked successfully"})
+}
+
+// GetPublicQuestlineHandler handles GET /api/public/{token}
+func GetPublicQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	link, err := db.GetShareLinkByToken(r.Context(), auth.HashToken(token))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Share link not found or expired")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+
+	ql, err := db.GetQuestline(r.Context(), link.QuestlineId)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	// only expose the questline itself, not who owns it or what other questlines it depends on or is broken down into
+	ql.OwnerId = ""
+	ql.ExternalDependencies = make([]models.ExternalDependency, 0)
+	ql.ChildQuestlines = nil
+
+	for i := range ql.Quests {
+		ql.Quests[i].ChildQuestlineId = ""
+		if link.RedactDescriptions {
+			ql.Quests[i].Description = ""
+		}
+	}
+	respondJSON(w, http.StatusOK, ql)
+}
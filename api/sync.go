@@ -0,0 +1,90 @@
+package api
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/events"
+	"barrettotte/questlines/logging"
+	"barrettotte/questlines/models"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const maxSyncChanges = 1000
+
+type SyncRequest struct {
+	Since   time.Time      `json:"since"`   // syncedAt of the last sync, or updated of the questline when it was fetched
+	Changes []events.Event `json:"changes"` // changes made offline since then
+}
+
+func (s SyncRequest) String() string {
+	return fmt.Sprintf("SyncRequest{Since: %v, Changes: %d}", s.Since.Format(time.RFC3339), len(s.Changes))
+}
+
+type SyncResponse struct {
+	Questline *models.Questline `json:"questline"`
+	Applied   int               `json:"applied"`
+	Conflicts []events.Conflict `json:"conflicts"`
+	SyncedAt  time.Time         `json:"syncedAt"` // since of the next sync
+}
+
+func (s SyncResponse) String() string {
+	return fmt.Sprintf("SyncResponse{Questline: '%v', Applied: %d, Conflicts: %v, SyncedAt: %v}",
+		s.Questline.Id, s.Applied, s.Conflicts, s.SyncedAt.Format(time.RFC3339Nano),
+	)
+}
+
+// SyncQuestlineHandler handles POST /api/questlines/{id}/sync, merging changes made offline into the questline
+func SyncQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req SyncRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	slog.InfoContext(r.Context(), "Syncing questline", "questline", id, "since", req.Since, "changes", len(req.Changes))
+	logging.Payload(r.Context(), "Changes to sync", req)
+
+	if req.Since.IsZero() {
+		respondInvalid(w, []models.FieldError{{Field: "since", Message: "is required"}})
+		return
+	}
+	if len(req.Changes) > maxSyncChanges {
+		respondInvalid(w, []models.FieldError{{Field: "changes", Message: fmt.Sprintf("must have at most %d changes", maxSyncChanges)}})
+		return
+	}
+	if !authorizeQuestline(w, r, id, models.RoleEditor) {
+		return
+	}
+
+	resp := SyncResponse{}
+	before, updated, err := db.PatchQuestline(r.Context(), id, func(before *models.Questline) (*models.Questline, error) {
+		merged, applied, conflicts, err := events.Merge(before, req.Since, req.Changes)
+		if err != nil {
+			return nil, newRequestError(http.StatusBadRequest, err.Error())
+		}
+		if err := checkQuestline(merged); err != nil {
+			return nil, err
+		}
+		if err := checkChildQuestlines(r, merged, before); err != nil {
+			return nil, err
+		}
+		resp.Applied, resp.Conflicts = applied, conflicts
+		return merged, nil
+	})
+	if err != nil {
+		respondRequestError(w, err)
+		return
+	}
+	resp.Questline, resp.SyncedAt = updated, time.Now()
+
+	if len(resp.Conflicts) > 0 {
+		slog.InfoContext(r.Context(), "Merged questline with conflicts", "questline", id, "conflicts", len(resp.Conflicts))
+	}
+	publishChanges(r, before, updated)
+	updateParentQuests(r, id)
+	respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// CloneQuestlineHandler handles POST /api/questlines/{id}/clone
+func CloneQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	name := r.URL.Query().Get("name")
+	if !authorizeQuestline(w, r, id, models.RoleViewer) {
+		return
+	}
+
+	reset, err := parseBoolParam(r, "reset", false)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid reset flag")
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Cloning questline", "questline", id, "reset", reset)
+
+	cloned, err := db.CloneQuestline(r.Context(), id, auth.UserFrom(r.Context()).Id, name, reset)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	publishChanges(r, nil, cloned)
+	respondJSON(w, http.StatusCreated, cloned)
+}
+
+// CreateTemplateFromQuestlineHandler handles POST /api/questlines/{id}/template, only the owner of a questline
+// can publish it since every user can read templates
+func CreateTemplateFromQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	query := r.URL.Query()
+	if !authorizeQuestline(w, r, id, models.RoleOwner) {
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Creating template from questline", "questline", id)
+
+	created, err := db.CreateTemplateFromQuestline(r.Context(), id, auth.UserFrom(r.Context()).Id, query.Get("name"), query.Get("description"))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Questline not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// GetTemplatesHandler handles GET /api/templates
+func GetTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	infos, err := db.GetTemplateInfos(r.Context())
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, infos)
+}
+
+// CreateTemplateHandler handles POST /api/templates
+func CreateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var toCreate models.Template
+
+	if !decodeJSON(w, r, &toCreate) {
+		return
+	}
+
+	slog.InfoContext(r.Context(), "Creating template", "name", toCreate.Name)
+
+	toCreate.OwnerId = auth.UserFrom(r.Context()).Id
+
+	created, err := db.CreateTemplate(r.Context(), &toCreate)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// GetTemplateHandler handles GET /api/templates/{id}
+func GetTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	template, err := db.GetTemplate(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Template not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, template)
+}
+
+// DeleteTemplateHandler handles DELETE /api/templates/{id}, only the owner of a template can delete it
+func DeleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	toDelete := chi.URLParam(r, "id")
+	slog.InfoContext(r.Context(), "Deleting template", "template", toDelete)
+
+	if err := db.DeleteTemplate(r.Context(), toDelete, auth.UserFrom(r.Context()).Id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Template not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Template deleted successfully"})
+}
+
+// InstantiateTemplateHandler handles POST /api/templates/{id}/instantiate
+func InstantiateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	slog.InfoContext(r.Context(), "Creating questline from template", "template", id)
+
+	created, err := db.CreateQuestlineFromTemplate(r.Context(), id, auth.UserFrom(r.Context()).Id, r.URL.Query().Get("name"))
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Template not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	publishChanges(r, nil, created)
+	respondJSON(w, http.StatusCreated, created)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+type ApiTokenRequest struct {
+	Name          string `json:"name"`
+	Scope         string `json:"scope"`
+	ExpiresInDays int    `json:"expiresInDays"` // zero never expires
+}
+
+// GetApiTokensHandler handles GET /api/tokens
+func GetApiTokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens, err := db.GetApiTokens(r.Context(), auth.UserFrom(r.Context()).Id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, tokens)
+}
+
+// CreateApiTokenHandler handles POST /api/tokens
+func CreateApiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var toCreate ApiTokenRequest
+
+	if !decodeJSON(w, r, &toCreate) {
+		return
+	}
+
+	toCreate.Name = strings.TrimSpace(toCreate.Name)
+	if toCreate.Name == "" {
+		respondError(w, http.StatusBadRequest, "Token name is required")
+		return
+	}
+	if toCreate.Scope == "" {
+		toCreate.Scope = models.ScopeRead // default
+	}
+	if toCreate.Scope != models.ScopeRead && toCreate.Scope != models.ScopeWrite {
+		respondError(w, http.StatusBadRequest, "Scope must be one of read or write")
+		return
+	}
+	if toCreate.ExpiresInDays < 0 {
+		respondError(w, http.StatusBadRequest, "Token expiry cannot be negative")
+		return
+	}
+
+	raw, err := auth.NewApiToken()
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	token := models.ApiToken{UserId: auth.UserFrom(r.Context()).Id, Name: toCreate.Name, Scope: toCreate.Scope}
+	if toCreate.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, toCreate.ExpiresInDays)
+		token.Expires = &expires
+	}
+
+	slog.InfoContext(r.Context(), "Creating API token", "name", token.Name, "scope", token.Scope, "user", token.UserId)
+
+	created, err := db.CreateApiToken(r.Context(), &token, auth.HashToken(raw))
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	created.Token = raw
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// DeleteApiTokenHandler handles DELETE /api/tokens/{id}
+func DeleteApiTokenHandler(w http.ResponseWriter, r *http.Request) {
+	toDelete := chi.URLParam(r, "id")
+	slog.InfoContext(r.Context(), "Revoking API token", "token", toDelete)
+
+	if err := db.DeleteApiToken(r.Context(), toDelete, auth.UserFrom(r.Context()).Id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "API token not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "API token revoked successfully"})
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// TrashDays is how long deleted questlines and quests stay in the trash, kept until purged if zero
+var TrashDays = 30
+
+// GetTrashHandler handles GET /api/trash
+func GetTrashHandler(w http.ResponseWriter, r *http.Request) {
+	items, err := db.GetTrash(r.Context(), auth.UserFrom(r.Context()).Id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+
+	if TrashDays > 0 {
+		for i := range items {
+			purgeAt := items[i].DeletedAt.AddDate(0, 0, TrashDays)
+			items[i].PurgeAt = &purgeAt
+		}
+	}
+	respondJSON(w, http.StatusOK, items)
+}
+
+// RestoreQuestlineHandler handles POST /api/trash/questlines/{id}/restore
+func RestoreQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeDeletedQuestline(w, r, id, models.RoleOwner) {
+		return
+	}
+	slog.InfoContext(r.Context(), "Restoring questline", "questline", id)
+
+	if err := db.RestoreQuestline(r.Context(), id); err != nil {
+		respondTrashError(w, err, "Questline not found")
+		return
+	}
+
+	restored, err := db.GetQuestline(r.Context(), id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	publishChanges(r, nil, restored)
+	updateParentQuests(r, id)
+	respondJSON(w, http.StatusOK, restored)
+}
+
+// PurgeQuestlineHandler handles DELETE /api/trash/questlines/{id}
+func PurgeQuestlineHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !authorizeDeletedQuestline(w, r, id, models.RoleOwner) {
+		return
+	}
+	slog.InfoContext(r.Context(), "Purging questline", "questline", id)
+
+	if err := db.PurgeQuestline(r.Context(), id); err != nil {
+		respondTrashError(w, err, "Questline not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Questline purged successfully"})
+}
+
+// RestoreQuestHandler handles POST /api/trash/quests/{id}/restore
+func RestoreQuestHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	questlineId, ok := authorizeDeletedQuest(w, r, id)
+	if !ok {
+		return
+	}
+	slog.InfoContext(r.Context(), "Restoring quest", "questline", questlineId, "quest", id)
+
+	before, err := db.GetQuestline(r.Context(), questlineId)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	if err := db.RestoreQuest(r.Context(), questlineId, id); err != nil {
+		respondTrashError(w, err, "Quest not found")
+		return
+	}
+
+	after, err := db.GetQuestline(r.Context(), questlineId)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	publishChanges(r, before, after)
+	updateParentQuests(r, questlineId)
+	respondJSON(w, http.StatusOK, after)
+}
+
+// PurgeQuestHandler handles DELETE /api/trash/quests/{id}
+func PurgeQuestHandler(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	questlineId, ok := authorizeDeletedQuest(w, r, id)
+	if !ok {
+		return
+	}
+	slog.InfoContext(r.Context(), "Purging quest", "questline", questlineId, "quest", id)
+
+	if err := db.PurgeQuest(r.Context(), questlineId, id); err != nil {
+		respondTrashError(w, err, "Quest not found")
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Quest purged successfully"})
+}
+
+// helper for checking the current user can edit the questline of a quest in the trash, returns the questline
+func authorizeDeletedQuest(w http.ResponseWriter, r *http.Request, id string) (string, bool) {
+	questlineId, err := db.GetDeletedQuestQuestline(r.Context(), id)
+	if err != nil {
+		respondTrashError(w, err, "Quest not found")
+		return "", false
+	}
+	return questlineId, authorizeQuestline(w, r, questlineId, models.RoleEditor)
+}
+
+// helper for responding to errors of things that may have left the trash in the meantime
+func respondTrashError(w http.ResponseWriter, err error, notFound string) {
+	if errors.Is(err, db.ErrNotFound) {
+		respondError(w, http.StatusNotFound, notFound)
+	} else {
+		respondDbError(w, err)
+	}
+}
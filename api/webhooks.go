@@ -0,0 +1,166 @@
+package api
+
+import (
+	"barrettotte/questlines/auth"
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/events"
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/webhooks"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+)
+
+type WebhookRequest struct {
+	Url         string   `json:"url"`
+	QuestlineId string   `json:"questlineId"` // empty for every questline
+	Events      []string `json:"events"`      // empty for every event
+	Secret      string   `json:"secret"`      // generated if empty
+}
+
+// getOwnWebhook fetches a webhook of the current user, responding with an error if not found
+func getOwnWebhook(w http.ResponseWriter, r *http.Request, id string) (*models.Webhook, bool) {
+	hook, err := db.GetWebhook(r.Context(), id, auth.UserFrom(r.Context()).Id)
+	if err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return nil, false
+	}
+	return hook, true
+}
+
+// GetWebhooksHandler handles GET /api/webhooks
+func GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	hooks, err := db.GetWebhooks(r.Context(), auth.UserFrom(r.Context()).Id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	respondJSON(w, http.StatusOK, hooks)
+}
+
+// CreateWebhookHandler handles POST /api/webhooks
+func CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	var toCreate WebhookRequest
+
+	if !decodeJSON(w, r, &toCreate) {
+		return
+	}
+
+	target, err := url.Parse(strings.TrimSpace(toCreate.Url))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		respondError(w, http.StatusBadRequest, "Webhook URL must be an absolute http or https URL")
+		return
+	}
+	if err := webhooks.CheckHost(r.Context(), target.Hostname()); err != nil {
+		slog.InfoContext(r.Context(), "Rejected webhook target", "url", target.String(), "error", err)
+		respondError(w, http.StatusBadRequest, "Webhook URL must resolve to a public address")
+		return
+	}
+	for _, pattern := range toCreate.Events {
+		if !events.IsValidPattern(pattern) {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown event filter %s", pattern))
+			return
+		}
+	}
+	if toCreate.QuestlineId != "" && !authorizeQuestline(w, r, toCreate.QuestlineId, models.RoleOwner) {
+		return
+	}
+
+	if toCreate.Secret == "" {
+		secret, err := auth.NewToken()
+		if err != nil {
+			respondDbError(w, err)
+			return
+		}
+		toCreate.Secret = secret
+	}
+
+	hook := models.Webhook{
+		UserId:      auth.UserFrom(r.Context()).Id,
+		QuestlineId: toCreate.QuestlineId,
+		Url:         target.String(),
+		Secret:      toCreate.Secret,
+		Events:      toCreate.Events,
+	}
+	slog.InfoContext(r.Context(), "Creating webhook", "url", hook.Url, "user", hook.UserId)
+
+	created, err := db.CreateWebhook(r.Context(), &hook)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusCreated, created)
+}
+
+// GetWebhookHandler handles GET /api/webhooks/{id}
+func GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := getOwnWebhook(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	hook.Secret = ""
+	respondJSON(w, http.StatusOK, hook)
+}
+
+// DeleteWebhookHandler handles DELETE /api/webhooks/{id}
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	toDelete := chi.URLParam(r, "id")
+	slog.InfoContext(r.Context(), "Deleting webhook", "webhook", toDelete)
+
+	if err := db.DeleteWebhook(r.Context(), toDelete, auth.UserFrom(r.Context()).Id); err != nil {
+		if errors.Is(err, db.ErrNotFound) {
+			respondError(w, http.StatusNotFound, "Webhook not found")
+		} else {
+			respondDbError(w, err)
+		}
+		return
+	}
+	respondJSON(w, http.StatusOK, Message{Message: "Webhook deleted successfully"})
+}
+
+// GetWebhookDeliveriesHandler handles GET /api/webhooks/{id}/deliveries
+func GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := getOwnWebhook(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	deliveries, err := db.GetWebhookDeliveries(r.Context(), hook.Id)
+	if err != nil {
+		respondDbError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, deliveries)
+}
+
+// TestWebhookHandler handles POST /api/webhooks/{id}/test
+func TestWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	hook, ok := getOwnWebhook(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	slog.InfoContext(r.Context(), "Testing webhook", "webhook", hook.Id)
+
+	ping := events.Event{
+		Id:          uuid.New().String(),
+		Type:        webhooks.PingEvent,
+		QuestlineId: hook.QuestlineId,
+		UserId:      hook.UserId,
+		Time:        time.Now(),
+	}
+	respondJSON(w, http.StatusOK, webhooks.DeliverOnce(*hook, ping, 1))
+}
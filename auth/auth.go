@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	hashAlgorithm  = "pbkdf2-sha256"
+	hashIterations = 600_000 // OWASP recommendation for PBKDF2-HMAC-SHA256
+	hashSaltBytes  = 16
+	hashKeyBytes   = 32
+
+	tokenBytes = 32
+
+	// distinguishes personal API tokens from session tokens
+	ApiTokenPrefix = "qlt_"
+)
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type contextKey string
+
+const (
+	userContextKey  contextKey = "user"
+	scopeContextKey contextKey = "scope"
+)
+
+// HashPassword derives a salted hash of a password for storage
+func HashPassword(password string) (string, error) {
+	salt := make([]byte, hashSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, hashIterations, hashKeyBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive password hash: %w", err)
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", hashAlgorithm, hashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// CheckPassword verifies a password against a stored hash
+func CheckPassword(password string, encoded string) (bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != hashAlgorithm {
+		return false, ErrInvalidHash
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false, fmt.Errorf("failed to derive password hash: %w", err)
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1, nil
+}
+
+// NewToken generates a random token, only its hash should be stored
+func NewToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewApiToken generates a random personal API token, only its hash should be stored
+func NewApiToken() (string, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	return ApiTokenPrefix + token, nil
+}
+
+// IsApiToken checks if a token is a personal API token rather than a session token
+func IsApiToken(token string) bool {
+	return strings.HasPrefix(token, ApiTokenPrefix)
+}
+
+// HashToken hashes a token for storage and lookup
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithUser adds authenticated user to context
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userContextKey, user)
+}
+
+// UserFrom gets authenticated user from context
+func UserFrom(ctx context.Context) *models.User {
+	user, _ := ctx.Value(userContextKey).(*models.User)
+	return user
+}
+
+// WithScope adds scope of the API token used to authenticate to context
+func WithScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeContextKey, scope)
+}
+
+// ScopeFrom gets scope of the API token used to authenticate from context, empty for sessions
+func ScopeFrom(ctx context.Context) string {
+	scope, _ := ctx.Value(scopeContextKey).(string)
+	return scope
+}
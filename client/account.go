@@ -0,0 +1,293 @@
+package client
+
+import (
+	"barrettotte/questlines/events"
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/version"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// request and response bodies mirroring the api package, which can't be imported without the database
+
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+func (c Credentials) String() string {
+	return fmt.Sprintf("Credentials{Username: '%v'}", c.Username)
+}
+
+type SessionInfo struct {
+	User    *models.User `json:"user"`
+	Token   string       `json:"token"`
+	Expires time.Time    `json:"expires"`
+}
+
+func (s SessionInfo) String() string {
+	return fmt.Sprintf("SessionInfo{User: %v, Expires: %v}", s.User, s.Expires)
+}
+
+type ShareRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func (s ShareRequest) String() string {
+	return fmt.Sprintf("ShareRequest{Username: '%v', Role: '%v'}", s.Username, s.Role)
+}
+
+type ShareLinkRequest struct {
+	ExpiresInDays      int  `json:"expiresInDays"` // zero never expires
+	RedactDescriptions bool `json:"redactDescriptions"`
+}
+
+func (s ShareLinkRequest) String() string {
+	return fmt.Sprintf("ShareLinkRequest{ExpiresInDays: %d, RedactDescriptions: %v}", s.ExpiresInDays, s.RedactDescriptions)
+}
+
+type ApiTokenRequest struct {
+	Name          string `json:"name"`
+	Scope         string `json:"scope"`
+	ExpiresInDays int    `json:"expiresInDays"` // zero never expires
+}
+
+func (t ApiTokenRequest) String() string {
+	return fmt.Sprintf("ApiTokenRequest{Name: '%v', Scope: '%v', ExpiresInDays: %d}", t.Name, t.Scope, t.ExpiresInDays)
+}
+
+type DigestRequest struct {
+	Email     string `json:"email"`
+	Frequency string `json:"frequency"` // daily or weekly
+}
+
+func (d DigestRequest) String() string {
+	return fmt.Sprintf("DigestRequest{Email: '%v', Frequency: '%v'}", d.Email, d.Frequency)
+}
+
+type WebhookRequest struct {
+	Url         string   `json:"url"`
+	QuestlineId string   `json:"questlineId"` // empty for every questline
+	Events      []string `json:"events"`      // empty for every event
+	Secret      string   `json:"secret"`      // generated if empty
+}
+
+func (h WebhookRequest) String() string {
+	return fmt.Sprintf("WebhookRequest{Url: '%v', QuestlineId: '%v', Events: %v}", h.Url, h.QuestlineId, h.Events)
+}
+
+type SyncRequest struct {
+	Since   time.Time      `json:"since"`   // syncedAt of the last sync, or updated of the questline when it was fetched
+	Changes []events.Event `json:"changes"` // changes made offline since then
+}
+
+func (s SyncRequest) String() string {
+	return fmt.Sprintf("SyncRequest{Since: %v, Changes: %d}", s.Since.Format(time.RFC3339), len(s.Changes))
+}
+
+type SyncResponse struct {
+	Questline *models.Questline `json:"questline"`
+	Applied   int               `json:"applied"`
+	Conflicts []events.Conflict `json:"conflicts"`
+	SyncedAt  time.Time         `json:"syncedAt"` // since of the next sync
+}
+
+func (s SyncResponse) String() string {
+	return fmt.Sprintf("SyncResponse{Applied: %d, Conflicts: %v, SyncedAt: %v}", s.Applied, s.Conflicts, s.SyncedAt.Format(time.RFC3339Nano))
+}
+
+type HealthCheck struct {
+	Ok        bool   `json:"ok"`
+	LatencyMs int64  `json:"latencyMs"`
+	Error     string `json:"error,omitempty"`
+}
+
+func (c HealthCheck) String() string {
+	return fmt.Sprintf("HealthCheck{Ok: %v, LatencyMs: %d, Error: '%v'}", c.Ok, c.LatencyMs, c.Error)
+}
+
+type Liveness struct {
+	Status string       `json:"status"`
+	Uptime string       `json:"uptime"`
+	Build  version.Info `json:"build"`
+}
+
+func (l Liveness) String() string {
+	return fmt.Sprintf("Liveness{Status: '%v', Uptime: '%v', Build: %v}", l.Status, l.Uptime, l.Build)
+}
+
+type Readiness struct {
+	Status      string                 `json:"status"`
+	Uptime      string                 `json:"uptime"`
+	Build       version.Info           `json:"build"`
+	DbSizeBytes int64                  `json:"dbSizeBytes"`
+	Checks      map[string]HealthCheck `json:"checks"`
+}
+
+func (r Readiness) String() string {
+	return fmt.Sprintf("Readiness{Status: '%v', DbSizeBytes: %d, Checks: %v}", r.Status, r.DbSizeBytes, r.Checks)
+}
+
+// Register creates a user and uses its session for later requests
+func (c *Client) Register(ctx context.Context, username string, password string) (*SessionInfo, error) {
+	var session SessionInfo
+	if err := c.do(ctx, http.MethodPost, "/auth/register", nil, Credentials{Username: username, Password: password}, &session); err != nil {
+		return nil, err
+	}
+	c.Token = session.Token
+	return &session, nil
+}
+
+// Login starts a session and uses it for later requests
+func (c *Client) Login(ctx context.Context, username string, password string) (*SessionInfo, error) {
+	var session SessionInfo
+	if err := c.do(ctx, http.MethodPost, "/auth/login", nil, Credentials{Username: username, Password: password}, &session); err != nil {
+		return nil, err
+	}
+	c.Token = session.Token
+	return &session, nil
+}
+
+// Logout ends the current session
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodPost, "/auth/logout", nil, nil, nil); err != nil {
+		return err
+	}
+	c.Token = ""
+	return nil
+}
+
+// CurrentUser gets the authenticated user
+func (c *Client) CurrentUser(ctx context.Context) (*models.User, error) {
+	var user models.User
+	if err := c.do(ctx, http.MethodGet, "/auth/me", nil, nil, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetApiTokens lists API tokens of the current user, needs a session
+func (c *Client) GetApiTokens(ctx context.Context) ([]models.ApiToken, error) {
+	var tokens []models.ApiToken
+	err := c.do(ctx, http.MethodGet, "/tokens", nil, nil, &tokens)
+	return tokens, err
+}
+
+// CreateApiToken creates an API token, its secret is only returned now
+func (c *Client) CreateApiToken(ctx context.Context, req ApiTokenRequest) (*models.ApiToken, error) {
+	var token models.ApiToken
+	if err := c.do(ctx, http.MethodPost, "/tokens", nil, req, &token); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// DeleteApiToken revokes an API token
+func (c *Client) DeleteApiToken(ctx context.Context, tokenId string) error {
+	return c.do(ctx, http.MethodDelete, "/tokens/"+id(tokenId), nil, nil, nil)
+}
+
+// GetDigest gets digest subscription of the current user
+func (c *Client) GetDigest(ctx context.Context) (*models.DigestSubscription, error) {
+	var sub models.DigestSubscription
+	if err := c.do(ctx, http.MethodGet, "/digest", nil, nil, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// SetDigest subscribes the current user to digests
+func (c *Client) SetDigest(ctx context.Context, req DigestRequest) (*models.DigestSubscription, error) {
+	var sub models.DigestSubscription
+	if err := c.do(ctx, http.MethodPut, "/digest", nil, req, &sub); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// DeleteDigest unsubscribes the current user from digests
+func (c *Client) DeleteDigest(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/digest", nil, nil, nil)
+}
+
+// PreviewDigest renders the next digest as text or html
+func (c *Client) PreviewDigest(ctx context.Context, html bool) (string, error) {
+	query := url.Values{}
+	if html {
+		query.Set("format", "html")
+	}
+	return c.text(ctx, "/digest/preview", query)
+}
+
+// SendDigest sends the next digest now
+func (c *Client) SendDigest(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, "/digest/send", nil, nil, nil)
+}
+
+// GetWebhooks lists webhooks of the current user
+func (c *Client) GetWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	var hooks []models.Webhook
+	err := c.do(ctx, http.MethodGet, "/webhooks", nil, nil, &hooks)
+	return hooks, err
+}
+
+// CreateWebhook creates a webhook, its secret is only returned now
+func (c *Client) CreateWebhook(ctx context.Context, req WebhookRequest) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := c.do(ctx, http.MethodPost, "/webhooks", nil, req, &hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// GetWebhook gets a webhook
+func (c *Client) GetWebhook(ctx context.Context, webhookId string) (*models.Webhook, error) {
+	var hook models.Webhook
+	if err := c.do(ctx, http.MethodGet, "/webhooks/"+id(webhookId), nil, nil, &hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// DeleteWebhook deletes a webhook
+func (c *Client) DeleteWebhook(ctx context.Context, webhookId string) error {
+	return c.do(ctx, http.MethodDelete, "/webhooks/"+id(webhookId), nil, nil, nil)
+}
+
+// GetWebhookDeliveries lists recent deliveries of a webhook
+func (c *Client) GetWebhookDeliveries(ctx context.Context, webhookId string) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	err := c.do(ctx, http.MethodGet, "/webhooks/"+id(webhookId)+"/deliveries", nil, nil, &deliveries)
+	return deliveries, err
+}
+
+// TestWebhook sends a ping event to a webhook once
+func (c *Client) TestWebhook(ctx context.Context, webhookId string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := c.do(ctx, http.MethodPost, "/webhooks/"+id(webhookId)+"/test", nil, nil, &delivery); err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// Live checks if the server is up
+func (c *Client) Live(ctx context.Context) (*Liveness, error) {
+	var live Liveness
+	if err := c.do(ctx, http.MethodGet, "/health/live", nil, nil, &live); err != nil {
+		return nil, err
+	}
+	return &live, nil
+}
+
+// Ready checks if the server can serve requests, failing with a 503 error if not
+func (c *Client) Ready(ctx context.Context) (*Readiness, error) {
+	var ready Readiness
+	if err := c.do(ctx, http.MethodGet, "/health/ready", nil, nil, &ready); err != nil {
+		return nil, err
+	}
+	return &ready, nil
+}
@@ -0,0 +1,168 @@
+package client
+
+import (
+	"barrettotte/questlines/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	apiPrefix       = "/api"
+	jsonContentType = "application/json"
+)
+
+// Client calls the API of a remote questlines server, see /api/openapi.json
+type Client struct {
+	BaseUrl    string // like https://questlines.example.com
+	Token      string // session or API token sent as bearer token
+	HttpClient *http.Client
+}
+
+// New creates client for a server, token can be empty until logging in
+func New(baseUrl string, token string) *Client {
+	return &Client{
+		BaseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		Token:      token,
+		HttpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Error is a problem details response from the server
+type Error struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail"`
+	RequestId string              `json:"requestId"`
+	Errors    []models.FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("questlines: %d %s", e.Status, e.Title)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	for _, fe := range e.Errors {
+		msg += fmt.Sprintf("; %s %s", fe.Field, fe.Message)
+	}
+	return msg
+}
+
+// helper for checking status of an error response
+func hasStatus(err error, status int) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Status == status
+}
+
+// IsNotFound checks if server responded 404
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict checks if server responded 409
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsUnauthorized checks if server responded 401
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// helper for building request URLs
+func (c *Client) url(path string, query url.Values) string {
+	u := c.BaseUrl + apiPrefix + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// send makes a request, returning the response if it succeeded and a problem otherwise
+func (c *Client) send(ctx context.Context, method string, path string, query url.Values, contentType string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path, query), reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %s: %w", method, path, err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+
+		apiErr := &Error{Status: resp.StatusCode, Title: http.StatusText(resp.StatusCode)}
+		if data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20)); err == nil {
+			json.Unmarshal(data, apiErr)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// do makes a request and decodes its json response into out, unless out is nil
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body any, out any) error {
+	return c.doAs(ctx, method, path, query, jsonContentType, body, out)
+}
+
+// doAs is do with a body of another content type than json, like a patch
+func (c *Client) doAs(ctx context.Context, method string, path string, query url.Values, contentType string, body any, out any) error {
+	resp, err := c.send(ctx, method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// text makes a request for a non-json response like a calendar feed
+func (c *Client) text(ctx context.Context, path string, query url.Values) (string, error) {
+	resp, err := c.send(ctx, http.MethodGet, path, query, "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response of %s: %w", path, err)
+	}
+	return string(data), nil
+}
+
+// helper for escaping IDs in paths
+func id(s string) string {
+	return url.PathEscape(s)
+}
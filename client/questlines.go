@@ -0,0 +1,309 @@
+package client
+
+import (
+	"barrettotte/questlines/events"
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/patch"
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// GetQuestlines lists questlines owned by or shared with the current user
+func (c *Client) GetQuestlines(ctx context.Context) ([]models.QuestlineInfo, error) {
+	var infos []models.QuestlineInfo
+	err := c.do(ctx, http.MethodGet, "/questlines", nil, nil, &infos)
+	return infos, err
+}
+
+// GetQuestline gets a questline with all its quests
+func (c *Client) GetQuestline(ctx context.Context, questlineId string) (*models.Questline, error) {
+	var ql models.Questline
+	if err := c.do(ctx, http.MethodGet, "/questlines/"+id(questlineId), nil, nil, &ql); err != nil {
+		return nil, err
+	}
+	return &ql, nil
+}
+
+// CreateQuestline creates a questline, the server assigns its ID
+func (c *Client) CreateQuestline(ctx context.Context, ql *models.Questline) (*models.Questline, error) {
+	var created models.Questline
+	if err := c.do(ctx, http.MethodPost, "/questlines", nil, ql, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateQuestline replaces a questline
+func (c *Client) UpdateQuestline(ctx context.Context, ql *models.Questline) (*models.Questline, error) {
+	var updated models.Questline
+	if err := c.do(ctx, http.MethodPut, "/questlines/"+id(ql.Id), nil, ql, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// PatchQuestline applies JSON Patch operations to a questline, all or none of them are applied
+func (c *Client) PatchQuestline(ctx context.Context, questlineId string, ops []patch.Operation) (*models.Questline, error) {
+	var patched models.Questline
+	if err := c.doAs(ctx, http.MethodPatch, "/questlines/"+id(questlineId), nil, patch.JsonPatchContentType, ops, &patched); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// MergePatchQuestline applies a JSON Merge Patch like map[string]any{"name": "Renamed"} to a questline
+func (c *Client) MergePatchQuestline(ctx context.Context, questlineId string, mergePatch any) (*models.Questline, error) {
+	var patched models.Questline
+	if err := c.doAs(ctx, http.MethodPatch, "/questlines/"+id(questlineId), nil, patch.MergePatchContentType, mergePatch, &patched); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+// DeleteQuestline moves a questline to the trash
+func (c *Client) DeleteQuestline(ctx context.Context, questlineId string) error {
+	return c.do(ctx, http.MethodDelete, "/questlines/"+id(questlineId), nil, nil, nil)
+}
+
+// GetTrash lists questlines and quests in the trash
+func (c *Client) GetTrash(ctx context.Context) ([]models.TrashItem, error) {
+	var items []models.TrashItem
+	err := c.do(ctx, http.MethodGet, "/trash", nil, nil, &items)
+	return items, err
+}
+
+// RestoreQuestline takes a questline out of the trash
+func (c *Client) RestoreQuestline(ctx context.Context, questlineId string) (*models.Questline, error) {
+	var ql models.Questline
+	if err := c.do(ctx, http.MethodPost, "/trash/questlines/"+id(questlineId)+"/restore", nil, nil, &ql); err != nil {
+		return nil, err
+	}
+	return &ql, nil
+}
+
+// PurgeQuestline permanently deletes a questline in the trash
+func (c *Client) PurgeQuestline(ctx context.Context, questlineId string) error {
+	return c.do(ctx, http.MethodDelete, "/trash/questlines/"+id(questlineId), nil, nil, nil)
+}
+
+// RestoreQuest takes a quest out of the trash, returning its questline
+func (c *Client) RestoreQuest(ctx context.Context, questId string) (*models.Questline, error) {
+	var ql models.Questline
+	if err := c.do(ctx, http.MethodPost, "/trash/quests/"+id(questId)+"/restore", nil, nil, &ql); err != nil {
+		return nil, err
+	}
+	return &ql, nil
+}
+
+// PurgeQuest permanently deletes a quest in the trash
+func (c *Client) PurgeQuest(ctx context.Context, questId string) error {
+	return c.do(ctx, http.MethodDelete, "/trash/quests/"+id(questId), nil, nil, nil)
+}
+
+// GetAvailableQuests gets quests of a questline whose prerequisites are completed
+func (c *Client) GetAvailableQuests(ctx context.Context, questlineId string) ([]models.AvailableQuest, error) {
+	var available []models.AvailableQuest
+	err := c.do(ctx, http.MethodGet, "/questlines/"+id(questlineId)+"/available", nil, nil, &available)
+	return available, err
+}
+
+// GetNextQuests gets quests available across all questlines, all of them if limit is zero
+func (c *Client) GetNextQuests(ctx context.Context, limit int) ([]models.AvailableQuest, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var next []models.AvailableQuest
+	err := c.do(ctx, http.MethodGet, "/next", query, nil, &next)
+	return next, err
+}
+
+// SyncQuestline merges changes made offline since the last sync, conflicts are resolved by the newer change
+func (c *Client) SyncQuestline(ctx context.Context, questlineId string, since time.Time, changes []events.Event) (*SyncResponse, error) {
+	var resp SyncResponse
+	if err := c.do(ctx, http.MethodPost, "/questlines/"+id(questlineId)+"/sync", nil, SyncRequest{Since: since, Changes: changes}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Batch applies operations across questlines, all of them or none if any fails
+func (c *Client) Batch(ctx context.Context, ops []models.BatchOperation) (*models.BatchResponse, error) {
+	var resp models.BatchResponse
+	if err := c.do(ctx, http.MethodPost, "/batch", nil, models.BatchRequest{Operations: ops}, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetQuestlineAnalysis gets critical path and progress of a questline
+func (c *Client) GetQuestlineAnalysis(ctx context.Context, questlineId string, weighted bool) (*models.QuestlineAnalysis, error) {
+	query := url.Values{"weighted": {strconv.FormatBool(weighted)}}
+
+	var analysis models.QuestlineAnalysis
+	if err := c.do(ctx, http.MethodGet, "/questlines/"+id(questlineId)+"/analysis", query, nil, &analysis); err != nil {
+		return nil, err
+	}
+	return &analysis, nil
+}
+
+// GetObjectiveHistory gets completion history of a recurring objective
+func (c *Client) GetObjectiveHistory(ctx context.Context, questlineId string, objectiveId string) ([]models.ObjectiveCompletion, error) {
+	var history []models.ObjectiveCompletion
+	err := c.do(ctx, http.MethodGet, "/questlines/"+id(questlineId)+"/objectives/"+id(objectiveId)+"/history", nil, nil, &history)
+	return history, err
+}
+
+// LayoutQuestline arranges quests automatically, empty algorithm and direction use the server defaults
+func (c *Client) LayoutQuestline(ctx context.Context, questlineId string, algo string, direction string) (*models.Questline, error) {
+	query := url.Values{}
+	if algo != "" {
+		query.Set("algo", algo)
+	}
+	if direction != "" {
+		query.Set("dir", direction)
+	}
+
+	var ql models.Questline
+	if err := c.do(ctx, http.MethodPost, "/questlines/"+id(questlineId)+"/layout", query, nil, &ql); err != nil {
+		return nil, err
+	}
+	return &ql, nil
+}
+
+// CloneQuestline copies a questline, optionally resetting progress of the copy
+func (c *Client) CloneQuestline(ctx context.Context, questlineId string, name string, reset bool) (*models.Questline, error) {
+	query := url.Values{"reset": {strconv.FormatBool(reset)}}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	var ql models.Questline
+	if err := c.do(ctx, http.MethodPost, "/questlines/"+id(questlineId)+"/clone", query, nil, &ql); err != nil {
+		return nil, err
+	}
+	return &ql, nil
+}
+
+// ExportQuestline downloads a questline as json
+func (c *Client) ExportQuestline(ctx context.Context, questlineId string) (string, error) {
+	return c.text(ctx, "/questlines/"+id(questlineId)+"/export", url.Values{"fmt": {"json"}})
+}
+
+// GetQuestlineCalendar gets iCalendar feed of a questline, as all-day events instead of tasks if events is set
+func (c *Client) GetQuestlineCalendar(ctx context.Context, questlineId string, events bool) (string, error) {
+	return c.text(ctx, "/questlines/"+id(questlineId)+"/calendar.ics", url.Values{"events": {strconv.FormatBool(events)}})
+}
+
+// GetCalendar gets iCalendar feed of all questlines
+func (c *Client) GetCalendar(ctx context.Context, events bool) (string, error) {
+	return c.text(ctx, "/calendar.ics", url.Values{"events": {strconv.FormatBool(events)}})
+}
+
+// GetQuestlinePermissions lists users a questline is shared with
+func (c *Client) GetQuestlinePermissions(ctx context.Context, questlineId string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := c.do(ctx, http.MethodGet, "/questlines/"+id(questlineId)+"/permissions", nil, nil, &permissions)
+	return permissions, err
+}
+
+// ShareQuestline shares a questline with a user as viewer or editor
+func (c *Client) ShareQuestline(ctx context.Context, questlineId string, username string, role string) ([]models.Permission, error) {
+	var permissions []models.Permission
+	err := c.do(ctx, http.MethodPut, "/questlines/"+id(questlineId)+"/permissions", nil, ShareRequest{Username: username, Role: role}, &permissions)
+	return permissions, err
+}
+
+// UnshareQuestline stops sharing a questline with a user
+func (c *Client) UnshareQuestline(ctx context.Context, questlineId string, userId string) error {
+	return c.do(ctx, http.MethodDelete, "/questlines/"+id(questlineId)+"/permissions/"+id(userId), nil, nil, nil)
+}
+
+// CreateShareLink creates a public read-only link, its token is only returned now
+func (c *Client) CreateShareLink(ctx context.Context, questlineId string, req ShareLinkRequest) (*models.ShareLink, error) {
+	var link models.ShareLink
+	if err := c.do(ctx, http.MethodPost, "/questlines/"+id(questlineId)+"/share", nil, req, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// GetShareLinks lists share links of a questline
+func (c *Client) GetShareLinks(ctx context.Context, questlineId string) ([]models.ShareLink, error) {
+	var links []models.ShareLink
+	err := c.do(ctx, http.MethodGet, "/questlines/"+id(questlineId)+"/shares", nil, nil, &links)
+	return links, err
+}
+
+// DeleteShareLink revokes a share link
+func (c *Client) DeleteShareLink(ctx context.Context, questlineId string, shareId string) error {
+	return c.do(ctx, http.MethodDelete, "/questlines/"+id(questlineId)+"/shares/"+id(shareId), nil, nil, nil)
+}
+
+// GetPublicQuestline gets a questline through a share link token, no authentication needed
+func (c *Client) GetPublicQuestline(ctx context.Context, token string) (*models.Questline, error) {
+	var ql models.Questline
+	if err := c.do(ctx, http.MethodGet, "/public/"+id(token), nil, nil, &ql); err != nil {
+		return nil, err
+	}
+	return &ql, nil
+}
+
+// GetTemplates lists templates
+func (c *Client) GetTemplates(ctx context.Context) ([]models.TemplateInfo, error) {
+	var infos []models.TemplateInfo
+	err := c.do(ctx, http.MethodGet, "/templates", nil, nil, &infos)
+	return infos, err
+}
+
+// GetTemplate gets a template
+func (c *Client) GetTemplate(ctx context.Context, templateId string) (*models.Template, error) {
+	var template models.Template
+	if err := c.do(ctx, http.MethodGet, "/templates/"+id(templateId), nil, nil, &template); err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// CreateTemplate creates a template
+func (c *Client) CreateTemplate(ctx context.Context, template *models.Template) (*models.Template, error) {
+	var created models.Template
+	if err := c.do(ctx, http.MethodPost, "/templates", nil, template, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// CreateTemplateFromQuestline creates a template from a questline
+func (c *Client) CreateTemplateFromQuestline(ctx context.Context, questlineId string, name string, description string) (*models.Template, error) {
+	query := url.Values{"name": {name}, "description": {description}}
+
+	var created models.Template
+	if err := c.do(ctx, http.MethodPost, "/questlines/"+id(questlineId)+"/template", query, nil, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// DeleteTemplate deletes a template
+func (c *Client) DeleteTemplate(ctx context.Context, templateId string) error {
+	return c.do(ctx, http.MethodDelete, "/templates/"+id(templateId), nil, nil, nil)
+}
+
+// InstantiateTemplate creates a questline from a template, named after the template if name is empty
+func (c *Client) InstantiateTemplate(ctx context.Context, templateId string, name string) (*models.Questline, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	var ql models.Questline
+	if err := c.do(ctx, http.MethodPost, "/templates/"+id(templateId)+"/instantiate", query, nil, &ql); err != nil {
+		return nil, err
+	}
+	return &ql, nil
+}
@@ -0,0 +1,61 @@
+// Command webhook-receiver is a local HTTP receiver for testing questline webhooks.
+// It verifies signatures and prints every delivery it receives.
+package main
+
+import (
+	"barrettotte/questlines/webhooks"
+	"bytes"
+	"crypto/hmac"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync/atomic"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "Address to listen on")
+	secret := flag.String("secret", "", "Webhook secret used to verify signatures, skipped if empty")
+	failFirst := flag.Int("fail", 0, "Respond with 500 to the first N deliveries to test retries")
+	flag.Parse()
+
+	var received atomic.Int64
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read body", http.StatusBadRequest)
+			return
+		}
+		n := received.Add(1)
+
+		signature := r.Header.Get(webhooks.SignatureHeader)
+		if *secret != "" && !hmac.Equal([]byte(signature), []byte(webhooks.Sign(*secret, body))) {
+			log.Printf("#%d rejected %s delivery %s: invalid signature %s", n,
+				r.Header.Get(webhooks.EventHeader), r.Header.Get(webhooks.DeliveryHeader), signature,
+			)
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var pretty bytes.Buffer
+		if err := json.Indent(&pretty, body, "", "  "); err != nil {
+			pretty.Write(body)
+		}
+		log.Printf("#%d received %s delivery %s\n%s", n,
+			r.Header.Get(webhooks.EventHeader), r.Header.Get(webhooks.DeliveryHeader), pretty.String(),
+		)
+
+		if n <= int64(*failFirst) {
+			http.Error(w, "simulated failure", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	log.Printf("Listening for webhooks on %s...", *addr)
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		log.Fatalf("Receiver failed to start: %v", err)
+	}
+}
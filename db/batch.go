@@ -0,0 +1,155 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// BatchError is the operation that failed a batch, nothing of the batch is saved
+type BatchError struct {
+	Index int
+	Op    string
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d (%s): %v", e.Index, e.Op, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyBatch applies operations across questlines in one transaction, all or nothing.
+// Returns the result of each operation and the changed questlines before and after the batch
+func ApplyBatch(ctx context.Context, ops []models.BatchOperation) ([]models.BatchResult, []*models.Questline, []*models.Questline, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to begin batch transaction: %w", dbError(err))
+	}
+	defer tx.Rollback()
+
+	// questlines are loaded on first use and changed in memory, then saved together
+	changed := make(map[string]*models.Questline)
+	before := make([]*models.Questline, 0)
+	results := make([]models.BatchResult, 0, len(ops))
+
+	for i, op := range ops {
+		ql, ok := changed[op.QuestlineId]
+		if !ok {
+			original, err := getQuestline(ctx, tx, op.QuestlineId)
+			if err != nil {
+				return nil, nil, nil, &BatchError{Index: i, Op: op.Op, Err: err}
+			}
+			ql = original.Clone()
+			before = append(before, original)
+			changed[op.QuestlineId] = ql
+		}
+
+		result, err := applyBatchOperation(ql, op)
+		if err != nil {
+			return nil, nil, nil, &BatchError{Index: i, Op: op.Op, Err: err}
+		}
+		result.Index = i
+		results = append(results, result)
+	}
+
+	for _, b := range before {
+		ql := changed[b.Id]
+		if errs := ql.Validate(); len(errs) > 0 {
+			return nil, nil, nil, clientError(ErrValidation, "questline %s is invalid after batch, %s %s", ql.Id, errs[0].Field, errs[0].Message)
+		}
+		if err := saveQuestline(ctx, tx, ql, true); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to save questline %s: %w", ql.Id, dbError(err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to commit batch: %w", dbError(err))
+	}
+	slog.DebugContext(ctx, "Applied batch", "operations", len(ops), "questlines", len(before))
+
+	after := make([]*models.Questline, 0, len(before))
+	for _, b := range before {
+		ql, err := GetQuestline(ctx, b.Id)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		after = append(after, ql)
+	}
+	return results, before, after, nil
+}
+
+// helper for finding a quest of a questline by ID
+func findQuest(ql *models.Questline, questId string) int {
+	return slices.IndexFunc(ql.Quests, func(q models.Quest) bool {
+		return q.Id == questId
+	})
+}
+
+// applies a single batch operation to a questline in memory
+func applyBatchOperation(ql *models.Questline, op models.BatchOperation) (models.BatchResult, error) {
+	result := models.BatchResult{Op: op.Op, QuestlineId: ql.Id, QuestId: op.QuestId}
+
+	if op.Op == models.BatchAddDependency {
+		for _, questId := range []string{op.From, op.To} {
+			if findQuest(ql, questId) < 0 {
+				return result, clientError(ErrNotFound, "quest %s not found in questline %s", questId, ql.Id)
+			}
+		}
+		for _, d := range ql.Dependencies {
+			if d.From == op.From && d.To == op.To {
+				return result, clientError(ErrConflict, "dependency from %s to %s already exists", op.From, op.To)
+			}
+		}
+		ql.Dependencies = append(ql.Dependencies, models.Dependency{From: op.From, To: op.To})
+		result.QuestId = op.To
+		return result, nil
+	}
+
+	i := findQuest(ql, op.QuestId)
+	if i < 0 {
+		return result, clientError(ErrNotFound, "quest %s not found in questline %s", op.QuestId, ql.Id)
+	}
+	quest := &ql.Quests[i]
+
+	switch op.Op {
+	case models.BatchCompleteQuest:
+		if quest.ChildQuestlineId != "" {
+			return result, clientError(ErrValidation, "completion of quest %s is derived from questline %s", quest.Id, quest.ChildQuestlineId)
+		}
+		quest.Completed = op.Completed == nil || *op.Completed
+
+	case models.BatchAddObjective:
+		objective := *op.Objective
+		if objective.Id == "" {
+			objective.Id = uuid.New().String()
+		}
+		objective.SortIndex = 0
+		for _, o := range quest.Objectives {
+			objective.SortIndex = max(objective.SortIndex, o.SortIndex+1)
+		}
+		quest.Objectives = append(quest.Objectives, objective)
+		result.ObjectiveId = objective.Id
+
+	case models.BatchMoveQuest:
+		quest.Position = *op.Position
+
+	case models.BatchDeleteQuest:
+		ql.Quests = slices.Delete(ql.Quests, i, i+1)
+		ql.Dependencies = slices.DeleteFunc(ql.Dependencies, func(d models.Dependency) bool {
+			return d.From == op.QuestId || d.To == op.QuestId
+		})
+		ql.ExternalDependencies = slices.DeleteFunc(ql.ExternalDependencies, func(d models.ExternalDependency) bool {
+			return d.To == op.QuestId
+		})
+
+	default:
+		return result, clientError(ErrValidation, "unknown op '%s'", op.Op)
+	}
+	return result, nil
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ParentChange is a questline whose quests were completed or reopened because a questline they are broken down into changed
+type ParentChange struct {
+	Before *models.Questline
+	After  *models.Questline
+}
+
+func (c ParentChange) String() string {
+	return fmt.Sprintf("ParentChange{QuestlineId: '%v'}", c.After.Id)
+}
+
+// fetches progress of questlines that quests of a questline are broken down into, leaving out the trash
+func getChildQuestlines(ctx context.Context, q querier, id string) ([]models.ChildQuestline, error) {
+	query := `
+		SELECT q.id, cql.id, cql.name, COUNT(c.id), COALESCE(SUM(c.completed), 0)
+		FROM quests AS q
+		JOIN questlines AS cql ON cql.id=q.child_questline_id AND cql.deleted_at IS NULL
+		LEFT JOIN quests AS c ON c.questline_id=cql.id AND c.deleted_at IS NULL
+		WHERE q.questline_id=? AND q.deleted_at IS NULL
+		GROUP BY q.id, cql.id, cql.name
+	`
+	rows, err := q.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child questlines of questline %s: %w", id, dbError(err))
+	}
+	defer rows.Close()
+
+	children := make([]models.ChildQuestline, 0)
+	for rows.Next() {
+		var c models.ChildQuestline
+		if err := rows.Scan(&c.QuestId, &c.QuestlineId, &c.Name, &c.TotalQuests, &c.CompletedQuests); err != nil {
+			return nil, fmt.Errorf("failed to scan child questline of questline %s: %w", id, dbError(err))
+		}
+		children = append(children, c)
+	}
+	return children, nil
+}
+
+// fetches questlines that quests of a questline are broken down into, by quest ID
+func getQuestChildLinks(ctx context.Context, q querier, id string) (map[string]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT id, child_questline_id FROM quests WHERE questline_id=? AND child_questline_id IS NOT NULL AND deleted_at IS NULL", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query child questline links of questline %s: %w", id, dbError(err))
+	}
+	defer rows.Close()
+
+	links := make(map[string]string)
+	for rows.Next() {
+		var questId, childId string
+		if err := rows.Scan(&questId, &childId); err != nil {
+			return nil, fmt.Errorf("failed to scan child questline link of questline %s: %w", id, dbError(err))
+		}
+		links[questId] = childId
+	}
+	return links, nil
+}
+
+// checks a quest of a questline can be broken down into a child questline and gets whether all quests of the child are completed.
+// Questlines that contain their parent would never complete. Links that are already stored aren't checked again,
+// their child may have been moved to the trash since and is not completed until it is restored
+func childQuestlineCompleted(ctx context.Context, tx *sql.Tx, questlineId string, childId string, linked bool) (bool, error) {
+	var total, completed int
+	query := `
+		SELECT COUNT(c.id), COALESCE(SUM(c.completed), 0)
+		FROM questlines AS cql
+		LEFT JOIN quests AS c ON c.questline_id=cql.id AND c.deleted_at IS NULL
+		WHERE cql.id=? AND cql.deleted_at IS NULL
+		GROUP BY cql.id
+	`
+	if err := tx.QueryRowContext(ctx, query, childId).Scan(&total, &completed); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			if linked {
+				return false, nil
+			}
+			return false, clientError(ErrValidation, "child questline %s not found", childId)
+		}
+		return false, dbError(err)
+	}
+	if linked {
+		return total > 0 && completed == total, nil
+	}
+	if err := checkChildCycle(ctx, tx, questlineId, childId); err != nil {
+		return false, err
+	}
+	return total > 0 && completed == total, nil
+}
+
+// checks a child questline and the questlines broken down from it don't contain a questline
+func checkChildCycle(ctx context.Context, tx *sql.Tx, questlineId string, childId string) error {
+	cycleQuery := `
+		WITH RECURSIVE descendants(id) AS (
+			SELECT ?1
+			UNION
+			SELECT q.child_questline_id
+			FROM quests AS q
+			JOIN descendants AS d ON q.questline_id=d.id
+			WHERE q.child_questline_id IS NOT NULL AND q.deleted_at IS NULL
+		)
+		SELECT EXISTS (SELECT 1 FROM descendants WHERE id=?2)
+	`
+	var cycle bool
+	if err := tx.QueryRowContext(ctx, cycleQuery, childId, questlineId).Scan(&cycle); err != nil {
+		return dbError(err)
+	}
+	if cycle {
+		return clientError(ErrValidation, "child questline %s contains questline %s", childId, questlineId)
+	}
+	return nil
+}
+
+// UpdateParentQuests completes or reopens quests broken down into a questline after it changed, and their parents in turn.
+// Returns the questlines whose quests changed
+func UpdateParentQuests(ctx context.Context, questlineId string) ([]ParentChange, error) {
+	changes := make([]ParentChange, 0)
+	visited := map[string]bool{questlineId: true}
+	queue := []string{questlineId}
+
+	for len(queue) > 0 {
+		childId := queue[0]
+		queue = queue[1:]
+
+		parentIds, err := getParentQuestlineIds(ctx, childId)
+		if err != nil {
+			return changes, err
+		}
+		for _, parentId := range parentIds {
+			if visited[parentId] {
+				continue
+			}
+			visited[parentId] = true
+
+			change, err := updateParentQuests(ctx, parentId)
+			if err != nil {
+				return changes, err
+			}
+			if change != nil {
+				changes = append(changes, *change)
+				queue = append(queue, parentId)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// fetches questlines with quests broken down into a questline
+func getParentQuestlineIds(ctx context.Context, childId string) ([]string, error) {
+	query := `
+		SELECT DISTINCT q.questline_id
+		FROM quests AS q
+		JOIN questlines AS ql ON ql.id=q.questline_id
+		WHERE q.child_questline_id=? AND q.deleted_at IS NULL AND ql.deleted_at IS NULL
+	`
+	rows, err := DB.QueryContext(ctx, query, childId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query parents of questline %s: %w", childId, dbError(err))
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan parent of questline %s: %w", childId, dbError(err))
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// derives completion of quests of a questline from their child questlines, nil if nothing changed
+func updateParentQuests(ctx context.Context, id string) (*ParentChange, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin update parent quests transaction %s: %w", id, dbError(err))
+	}
+	defer tx.Rollback()
+
+	before, err := getQuestline(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// a child in the trash has no quests, so its parent quest is reopened until it is restored
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, `
+		UPDATE quests SET completed=NOT completed, completed_at=CASE WHEN completed THEN NULL ELSE ? END, updated=?
+		WHERE questline_id=? AND deleted_at IS NULL AND child_questline_id IS NOT NULL AND completed IS NOT (
+			SELECT COUNT(*) > 0 AND COUNT(*) = SUM(c.completed)
+			FROM quests AS c
+			JOIN questlines AS cql ON cql.id=c.questline_id
+			WHERE c.questline_id=quests.child_questline_id AND c.deleted_at IS NULL AND cql.deleted_at IS NULL
+		)
+	`, now, now, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update parent quests of questline %s: %w", id, dbError(err))
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to update parent quests of questline %s: %w", id, dbError(err))
+	}
+	if affected == 0 {
+		return nil, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE questlines SET updated=? WHERE id=?", now, id); err != nil {
+		return nil, fmt.Errorf("failed to update questline %s: %w", id, dbError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit parent quests of questline %s: %w", id, dbError(err))
+	}
+
+	after, err := GetQuestline(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &ParentChange{Before: before, After: after}, nil
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func scanDigestSubscription(row interface{ Scan(...any) error }) (*models.DigestSubscription, error) {
+	var sub models.DigestSubscription
+	var lastSent sql.NullTime
+
+	if err := row.Scan(&sub.UserId, &sub.Email, &sub.Frequency, &sub.Confirmed, &lastSent, &sub.Created); err != nil {
+		return nil, err
+	}
+	if lastSent.Valid {
+		sub.LastSent = &lastSent.Time
+	}
+	return &sub, nil
+}
+
+// GetDigestSubscription fetches digest subscription of a user
+func GetDigestSubscription(ctx context.Context, userId string) (*models.DigestSubscription, error) {
+	row := DB.QueryRowContext(ctx, "SELECT user_id, email, frequency, confirmed, last_sent, created FROM digest_subscriptions WHERE user_id=?", userId)
+	sub, err := scanDigestSubscription(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query digest subscription of user %s: %w", userId, dbError(err))
+	}
+	return sub, nil
+}
+
+// GetDigestSubscriptions fetches confirmed digest subscriptions of all users
+func GetDigestSubscriptions(ctx context.Context) ([]models.DigestSubscription, error) {
+	rows, err := DB.QueryContext(ctx, "SELECT user_id, email, frequency, confirmed, last_sent, created FROM digest_subscriptions WHERE confirmed")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query digest subscriptions: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	subs := make([]models.DigestSubscription, 0)
+	for rows.Next() {
+		sub, err := scanDigestSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan digest subscription: %w", dbError(err))
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, nil
+}
+
+// SetDigestSubscription creates or updates digest subscription of a user, changing the email needs it confirmed again
+func SetDigestSubscription(ctx context.Context, sub *models.DigestSubscription) (*models.DigestSubscription, error) {
+	_, err := DB.ExecContext(ctx, `
+		INSERT INTO digest_subscriptions (user_id, email, frequency, created) VALUES (?,?,?,?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			confirmed=confirmed AND email=excluded.email,
+			confirm_code_hash=CASE WHEN email=excluded.email THEN confirm_code_hash END,
+			email=excluded.email,
+			frequency=excluded.frequency`,
+		sub.UserId, sub.Email, sub.Frequency, time.Now(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upsert digest subscription of user %s: %w", sub.UserId, dbError(err))
+	}
+	return GetDigestSubscription(ctx, sub.UserId)
+}
+
+// SetDigestConfirmCode replaces the code that confirms the email of a user's digest subscription
+func SetDigestConfirmCode(ctx context.Context, userId string, codeHash string) error {
+	res, err := DB.ExecContext(ctx, "UPDATE digest_subscriptions SET confirm_code_hash=? WHERE user_id=? AND NOT confirmed", codeHash, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update confirm code of digest subscription of user %s: %w", userId, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to update confirm code of digest subscription of user %s: %w", userId, ErrNotFound)
+	}
+	return nil
+}
+
+// ConfirmDigestSubscription confirms the email of a user's digest subscription if the code matches
+func ConfirmDigestSubscription(ctx context.Context, userId string, codeHash string) (*models.DigestSubscription, error) {
+	res, err := DB.ExecContext(ctx,
+		"UPDATE digest_subscriptions SET confirmed=TRUE, confirm_code_hash=NULL WHERE user_id=? AND confirm_code_hash=?", userId, codeHash,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to confirm digest subscription of user %s: %w", userId, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return nil, fmt.Errorf("failed to confirm digest subscription of user %s: %w", userId, ErrNotFound)
+	}
+	return GetDigestSubscription(ctx, userId)
+}
+
+// ClaimDigestEmail records an email sent on request to a user's digest address,
+// false if one was already sent within the interval
+func ClaimDigestEmail(ctx context.Context, userId string, now time.Time, interval time.Duration) (bool, error) {
+	res, err := DB.ExecContext(ctx,
+		"UPDATE digest_subscriptions SET last_emailed=? WHERE user_id=? AND (last_emailed IS NULL OR last_emailed<=?)",
+		now, userId, now.Add(-interval),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to update last emailed of digest subscription of user %s: %w", userId, dbError(err))
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update last emailed of digest subscription of user %s: %w", userId, dbError(err))
+	}
+	return affected > 0, nil
+}
+
+// MarkDigestSent records when a user's digest was last sent
+func MarkDigestSent(ctx context.Context, userId string, sent time.Time) error {
+	if _, err := DB.ExecContext(ctx, "UPDATE digest_subscriptions SET last_sent=? WHERE user_id=?", sent, userId); err != nil {
+		return fmt.Errorf("failed to update digest subscription of user %s: %w", userId, dbError(err))
+	}
+	return nil
+}
+
+// DeleteDigestSubscription unsubscribes a user from digests
+func DeleteDigestSubscription(ctx context.Context, userId string) error {
+	res, err := DB.ExecContext(ctx, "DELETE FROM digest_subscriptions WHERE user_id=?", userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete digest subscription of user %s: %w", userId, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to delete digest subscription of user %s: %w", userId, ErrNotFound)
+	}
+	return nil
+}
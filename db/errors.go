@@ -0,0 +1,68 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// errors returned by db functions, check with errors.Is
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("conflict")
+	ErrValidation = errors.New("validation failed")
+)
+
+// InvalidError is a questline or template that failed validation, get its field errors with errors.As
+type InvalidError struct {
+	Errors []models.FieldError
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("%d invalid field(s)", len(e.Errors))
+}
+
+func (e *InvalidError) Unwrap() error {
+	return ErrValidation
+}
+
+// ClientError is a db error caused by the request, its message is safe to show to clients unlike the rest of the chain.
+// Get it with errors.As, it wraps one of ErrNotFound, ErrConflict or ErrValidation
+type ClientError struct {
+	Err     error
+	Message string
+}
+
+func (e *ClientError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *ClientError) Unwrap() error {
+	return e.Err
+}
+
+// helper for creating a client error with a message wrapping one of the sentinel errors
+func clientError(err error, format string, args ...any) error {
+	return &ClientError{Err: err, Message: fmt.Sprintf(format, args...)}
+}
+
+// dbError classifies driver errors as db errors, keeping the original error in the chain
+func dbError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint {
+		switch sqliteErr.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		default:
+			return fmt.Errorf("%w: %w", ErrValidation, err)
+		}
+	}
+	return err
+}
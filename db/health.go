@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// path of database file, empty for in-memory databases
+	dbPath string
+
+	// newest migration embedded in binary
+	latestMigration uint
+)
+
+type MigrationStatus struct {
+	Version uint `json:"version"`
+	Latest  uint `json:"latest"`
+	Dirty   bool `json:"dirty"`
+}
+
+func (s MigrationStatus) String() string {
+	return fmt.Sprintf("MigrationStatus{Version: %d, Latest: %d, Dirty: %v}", s.Version, s.Latest, s.Dirty)
+}
+
+// helper for getting file path from a data source name like file:questlines.db?_busy_timeout=5000
+func filePath(dataSourceName string) string {
+	path, _, _ := strings.Cut(strings.TrimPrefix(dataSourceName, "file:"), "?")
+	if path == ":memory:" || strings.Contains(dataSourceName, "mode=memory") {
+		return ""
+	}
+	return path
+}
+
+// GetMigrationStatus gets applied migration version and whether the last migration failed part way
+func GetMigrationStatus(ctx context.Context) (*MigrationStatus, error) {
+	status := MigrationStatus{Latest: latestMigration}
+	err := DB.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&status.Version, &status.Dirty)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query migration status: %w", dbError(err))
+	}
+	return &status, nil
+}
+
+// CheckWritable commits a write to prove the database file can be written
+func CheckWritable(ctx context.Context) error {
+	_, err := DB.ExecContext(ctx, `
+		INSERT INTO health_checks (id, checked) VALUES (1, ?)
+		ON CONFLICT(id) DO UPDATE SET checked=excluded.checked
+	`, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to write health check: %w", dbError(err))
+	}
+	return nil
+}
+
+// GetFileSize gets size in bytes of database file and its write-ahead log, zero for in-memory databases
+func GetFileSize() (int64, error) {
+	if dbPath == "" {
+		return 0, nil
+	}
+
+	var size int64
+	for _, path := range []string{dbPath, dbPath + "-wal"} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) && path != dbPath {
+				continue
+			}
+			return 0, fmt.Errorf("failed to stat database file %s: %w", path, err)
+		}
+		size += info.Size()
+	}
+	return size, nil
+}
@@ -0,0 +1,3 @@
+-- estimated effort used to weight questline analysis
+
+ALTER TABLE quests ADD COLUMN effort REAL DEFAULT 0 NOT NULL;
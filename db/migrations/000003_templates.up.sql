@@ -0,0 +1,10 @@
+-- reusable questline skeletons, stored apart from live questlines
+
+CREATE TABLE IF NOT EXISTS templates (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    questline TEXT NOT NULL, -- questline skeleton as JSON
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated DATETIME DEFAULT CURRENT_TIMESTAMP
+);
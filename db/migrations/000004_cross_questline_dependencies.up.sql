@@ -0,0 +1,5 @@
+-- dependencies are owned by the questline of their 'to' quest,
+-- while 'from' may be a quest in any questline
+
+CREATE INDEX IF NOT EXISTS idx_dependencies_from_id ON dependencies (from_id);
+CREATE INDEX IF NOT EXISTS idx_dependencies_to_id ON dependencies (to_id);
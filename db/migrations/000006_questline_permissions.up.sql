@@ -0,0 +1,13 @@
+-- questlines shared with other users, the creator in questlines.owner_id is always an owner
+
+CREATE TABLE IF NOT EXISTS questline_permissions (
+    questline_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    role TEXT NOT NULL CHECK (role IN ('viewer', 'editor', 'owner')),
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (questline_id, user_id),
+    FOREIGN KEY (questline_id) REFERENCES questlines(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_questline_permissions_user_id ON questline_permissions (user_id);
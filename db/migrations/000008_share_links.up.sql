@@ -0,0 +1,13 @@
+-- public read-only links to questlines, only token hashes are stored
+
+CREATE TABLE IF NOT EXISTS share_links (
+    id TEXT PRIMARY KEY,
+    questline_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    redact_descriptions BOOLEAN DEFAULT FALSE NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires DATETIME,
+    FOREIGN KEY (questline_id) REFERENCES questlines(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_links_questline_id ON share_links (questline_id);
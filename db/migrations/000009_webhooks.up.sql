@@ -0,0 +1,34 @@
+-- outgoing webhooks, questline_id is NULL for webhooks on every questline a user can access
+
+CREATE TABLE IF NOT EXISTS webhooks (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    questline_id TEXT,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT DEFAULT '[]' NOT NULL, -- JSON array of event filters, empty matches everything
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (questline_id) REFERENCES questlines(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_user_id ON webhooks (user_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_questline_id ON webhooks (questline_id);
+
+-- one row per delivery attempt
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    attempt INTEGER NOT NULL,
+    payload TEXT NOT NULL,
+    status_code INTEGER DEFAULT 0 NOT NULL,
+    error TEXT DEFAULT '' NOT NULL,
+    success BOOLEAN DEFAULT FALSE NOT NULL,
+    duration_ms INTEGER DEFAULT 0 NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id, created);
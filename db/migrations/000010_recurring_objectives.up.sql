@@ -0,0 +1,15 @@
+-- objectives with a recurrence rule reset every period, finished periods are kept for streaks
+
+ALTER TABLE objectives ADD COLUMN recurrence TEXT DEFAULT '' NOT NULL;
+ALTER TABLE objectives ADD COLUMN period_start DATETIME;
+
+CREATE TABLE IF NOT EXISTS objective_completions (
+    id TEXT PRIMARY KEY,
+    objective_id TEXT NOT NULL,
+    period_start DATETIME NOT NULL,
+    completed BOOLEAN DEFAULT FALSE NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (objective_id) REFERENCES objectives(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_objective_completions_objective_id ON objective_completions (objective_id, period_start);
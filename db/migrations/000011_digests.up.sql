@@ -0,0 +1,13 @@
+-- quest due dates and completion times for reminder digests
+
+ALTER TABLE quests ADD COLUMN due DATETIME;
+ALTER TABLE quests ADD COLUMN completed_at DATETIME; -- unknown for quests completed before this migration
+
+CREATE TABLE IF NOT EXISTS digest_subscriptions (
+    user_id TEXT PRIMARY KEY,
+    email TEXT NOT NULL,
+    frequency TEXT NOT NULL CHECK (frequency IN ('daily', 'weekly')),
+    last_sent DATETIME,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,3 @@
+-- due dates of objectives for calendar feeds
+
+ALTER TABLE objectives ADD COLUMN due DATETIME;
@@ -0,0 +1,6 @@
+-- single row rewritten by readiness checks to prove the database is writable
+
+CREATE TABLE IF NOT EXISTS health_checks (
+    id INTEGER PRIMARY KEY CHECK (id = 1),
+    checked DATETIME NOT NULL
+);
@@ -0,0 +1,7 @@
+-- last change of each quest and objective, for merging changes made offline
+
+ALTER TABLE quests ADD COLUMN updated DATETIME;
+ALTER TABLE objectives ADD COLUMN updated DATETIME;
+
+UPDATE quests SET updated=(SELECT ql.updated FROM questlines AS ql WHERE ql.id=quests.questline_id);
+UPDATE objectives SET updated=(SELECT q.updated FROM quests AS q WHERE q.id=objectives.quest_id);
@@ -0,0 +1,7 @@
+-- deleted questlines and quests stay in the trash until restored or purged
+
+ALTER TABLE questlines ADD COLUMN deleted_at DATETIME;
+ALTER TABLE quests ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_questlines_deleted_at ON questlines (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_quests_deleted_at ON quests (deleted_at);
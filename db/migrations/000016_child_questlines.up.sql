@@ -0,0 +1,5 @@
+-- quests broken down into their own questline, completed once every quest of it is
+
+ALTER TABLE quests ADD COLUMN child_questline_id TEXT REFERENCES questlines(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_quests_child_questline_id ON quests (child_questline_id);
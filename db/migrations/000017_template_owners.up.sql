@@ -0,0 +1,8 @@
+-- templates are shared with everyone but only their owner can delete them
+
+ALTER TABLE templates ADD COLUMN owner_id TEXT REFERENCES users(id) ON DELETE CASCADE;
+
+-- templates created before owners existed belong to the first user, or whoever registers first
+UPDATE templates SET owner_id=(SELECT id FROM users ORDER BY created LIMIT 1) WHERE owner_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_templates_owner_id ON templates (owner_id);
@@ -0,0 +1,15 @@
+-- events waiting to be delivered to webhooks, kept until delivered or out of attempts so none are lost
+
+CREATE TABLE IF NOT EXISTS webhook_queue (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    attempts INTEGER DEFAULT 0 NOT NULL,
+    next_attempt DATETIME NOT NULL,
+    created DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_queue_next_attempt ON webhook_queue (next_attempt);
@@ -0,0 +1,3 @@
+-- dependencies on quests in the trash are kept in the trash with them so restoring a quest brings them back
+
+ALTER TABLE dependencies ADD COLUMN deleted_at DATETIME;
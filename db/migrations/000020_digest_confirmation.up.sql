@@ -0,0 +1,6 @@
+-- digest addresses are confirmed with a code emailed to them before digests are sent,
+-- subscriptions from before this migration are confirmed again by subscribing again
+
+ALTER TABLE digest_subscriptions ADD COLUMN confirmed BOOLEAN DEFAULT FALSE NOT NULL;
+ALTER TABLE digest_subscriptions ADD COLUMN confirm_code_hash TEXT;
+ALTER TABLE digest_subscriptions ADD COLUMN last_emailed DATETIME; -- last confirmation or on demand digest, for rate limiting
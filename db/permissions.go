@@ -0,0 +1,105 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// GetQuestlineRole fetches the role a user has on a questline, empty if none
+func GetQuestlineRole(ctx context.Context, questlineId string, userId string) (string, error) {
+	return questlineRole(ctx, questlineId, userId, false)
+}
+
+// GetDeletedQuestlineRole fetches the role a user has on a questline in the trash, empty if none
+func GetDeletedQuestlineRole(ctx context.Context, questlineId string, userId string) (string, error) {
+	return questlineRole(ctx, questlineId, userId, true)
+}
+
+// helper for fetching role on questlines in or out of the trash
+func questlineRole(ctx context.Context, questlineId string, userId string, deleted bool) (string, error) {
+	var ownerId sql.NullString
+	var role sql.NullString
+
+	query := `
+		SELECT ql.owner_id, p.role
+		FROM questlines AS ql
+		LEFT JOIN questline_permissions AS p ON p.questline_id=ql.id AND p.user_id=?
+		WHERE ql.id=? AND (ql.deleted_at IS NOT NULL)=?
+	`
+	if err := DB.QueryRowContext(ctx, query, userId, questlineId, deleted).Scan(&ownerId, &role); err != nil {
+		return "", fmt.Errorf("failed to query role on questline %s: %w", questlineId, dbError(err))
+	}
+
+	if ownerId.Valid && ownerId.String == userId {
+		return models.RoleOwner, nil
+	}
+	return role.String, nil
+}
+
+// GetQuestRole fetches the role a user has on the questline of a quest, empty if none
+func GetQuestRole(ctx context.Context, questId string, userId string) (string, error) {
+	var questlineId string
+
+	err := DB.QueryRowContext(ctx, "SELECT questline_id FROM quests WHERE id=? AND deleted_at IS NULL", questId).Scan(&questlineId)
+	if err != nil {
+		return "", fmt.Errorf("failed to query questline of quest %s: %w", questId, dbError(err))
+	}
+	return GetQuestlineRole(ctx, questlineId, userId)
+}
+
+// GetQuestlinePermissions fetches everyone with access to a questline, starting with its creator
+func GetQuestlinePermissions(ctx context.Context, questlineId string) ([]models.Permission, error) {
+	query := `
+		SELECT u.id, u.username, 'owner', TRUE, ql.created
+		FROM questlines AS ql
+		JOIN users AS u ON u.id=ql.owner_id
+		WHERE ql.id=?1
+		UNION ALL
+		SELECT u.id, u.username, p.role, FALSE, p.created
+		FROM questline_permissions AS p
+		JOIN users AS u ON u.id=p.user_id
+		WHERE p.questline_id=?1
+	`
+
+	rows, err := DB.QueryContext(ctx, query, questlineId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query permissions for questline %s: %w", questlineId, dbError(err))
+	}
+	defer rows.Close()
+
+	permissions := make([]models.Permission, 0)
+	for rows.Next() {
+		p := models.Permission{QuestlineId: questlineId}
+		if err := rows.Scan(&p.UserId, &p.Username, &p.Role, &p.Creator, &p.Created); err != nil {
+			return nil, fmt.Errorf("failed to scan permission for questline %s: %w", questlineId, dbError(err))
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, nil
+}
+
+// SetQuestlinePermission shares a questline with a user or changes their role
+func SetQuestlinePermission(ctx context.Context, questlineId string, userId string, role string) error {
+	query := `
+		INSERT INTO questline_permissions (questline_id, user_id, role) VALUES (?,?,?)
+		ON CONFLICT(questline_id, user_id) DO UPDATE SET role=excluded.role
+	`
+	if _, err := DB.ExecContext(ctx, query, questlineId, userId, role); err != nil {
+		return fmt.Errorf("failed to set permission on questline %s for user %s: %w", questlineId, userId, dbError(err))
+	}
+	return nil
+}
+
+// DeleteQuestlinePermission stops sharing a questline with a user
+func DeleteQuestlinePermission(ctx context.Context, questlineId string, userId string) error {
+	res, err := DB.ExecContext(ctx, "DELETE FROM questline_permissions WHERE questline_id=? AND user_id=?", questlineId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete permission on questline %s for user %s: %w", questlineId, userId, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to delete permission on questline %s for user %s: %w", questlineId, userId, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/recurrence"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// currentPeriod normalizes a recurrence rule and gets the start of its current period, nil for one-shot objectives
+func currentPeriod(rule string) (string, *time.Time, error) {
+	if rule == "" {
+		return "", nil, nil
+	}
+	parsed, err := recurrence.Parse(rule)
+	if err != nil {
+		return "", nil, err
+	}
+	start := parsed.PeriodStart(time.Now())
+	return parsed.String(), &start, nil
+}
+
+// fillStreaks derives next reset and streaks of recurring objectives in a questline from their completion history
+func fillStreaks(ctx context.Context, q querier, questline *models.Questline) error {
+	history, err := objectiveHistory(ctx, q, "q.questline_id=?", questline.Id)
+	if err != nil {
+		return fmt.Errorf("failed to query objective completions for questline %s: %w", questline.Id, dbError(err))
+	}
+	applyStreaks(questline, history)
+	return nil
+}
+
+// helper for fetching finished periods of objectives by objective, oldest first, of quests matching a condition
+func objectiveHistory(ctx context.Context, q querier, condition string, args ...any) (map[string][]recurrence.Period, error) {
+	query := `
+		SELECT c.objective_id, c.period_start, c.completed
+		FROM objective_completions AS c
+		JOIN objectives AS o ON o.id=c.objective_id
+		JOIN quests AS q ON q.id=o.quest_id
+		WHERE ` + condition + `
+		ORDER BY c.period_start
+	`
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make(map[string][]recurrence.Period)
+	for rows.Next() {
+		var objectiveId string
+		var p recurrence.Period
+		if err := rows.Scan(&objectiveId, &p.Start, &p.Completed); err != nil {
+			return nil, err
+		}
+		history[objectiveId] = append(history[objectiveId], p)
+	}
+	return history, nil
+}
+
+// helper for deriving next reset and streaks of recurring objectives in a questline from their history
+func applyStreaks(questline *models.Questline, history map[string][]recurrence.Period) {
+	for i := range questline.Quests {
+		for j := range questline.Quests[i].Objectives {
+			o := &questline.Quests[i].Objectives[j]
+			if o.Recurrence == "" || o.PeriodStart == nil {
+				continue
+			}
+			rule, err := recurrence.Parse(o.Recurrence)
+			if err != nil {
+				continue // saved before rule validation, treat as one-shot
+			}
+			next := rule.Next(*o.PeriodStart)
+			o.NextReset = &next
+			o.Streak, o.BestStreak = rule.Streaks(history[o.Id], *o.PeriodStart, o.Completed)
+		}
+	}
+}
+
+// GetRecurringObjectives fetches all recurring objectives grouped by questline, except those in the trash
+func GetRecurringObjectives(ctx context.Context) (map[string][]models.Objective, error) {
+	query := `
+		SELECT q.questline_id, o.id, o.quest_id, o.text, o.completed, o.sort_index, o.recurrence, o.period_start
+		FROM objectives AS o
+		JOIN quests AS q ON q.id=o.quest_id
+		JOIN questlines AS ql ON ql.id=q.questline_id
+		WHERE o.recurrence != '' AND o.period_start IS NOT NULL AND q.deleted_at IS NULL AND ql.deleted_at IS NULL
+	`
+	rows, err := DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring objectives: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	objectives := make(map[string][]models.Objective)
+	for rows.Next() {
+		var questlineId string
+		var o models.Objective
+		var periodStart time.Time
+
+		if err := rows.Scan(&questlineId, &o.Id, &o.QuestId, &o.Text, &o.Completed, &o.SortIndex, &o.Recurrence, &periodStart); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring objective: %w", dbError(err))
+		}
+		o.PeriodStart = &periodStart
+		objectives[questlineId] = append(objectives[questlineId], o)
+	}
+	return objectives, nil
+}
+
+// ResetRecurringObjectives records the finished period of objectives and starts their next period.
+// Quests of objectives that were completed are no longer complete, but quests depending on them are left alone.
+// Objectives completed, reset or changed since they were fetched are read again or skipped.
+func ResetRecurringObjectives(ctx context.Context, questlineId string, objectives []models.Objective, now time.Time) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin reset objectives transaction %s: %w", questlineId, dbError(err))
+	}
+	defer tx.Rollback()
+
+	for _, o := range objectives {
+		rule, err := recurrence.Parse(o.Recurrence)
+		if err != nil {
+			return fmt.Errorf("failed to parse recurrence of objective %s: %w", o.Id, dbError(err))
+		}
+
+		// objectives are read again since they may have been completed, reset or changed after they were fetched
+		var periodStart time.Time
+		err = tx.QueryRowContext(ctx, "SELECT completed, period_start FROM objectives WHERE id=? AND recurrence=?", o.Id, o.Recurrence).Scan(&o.Completed, &periodStart)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to query objective %s: %w", o.Id, dbError(err))
+		}
+		if !periodStart.Equal(*o.PeriodStart) {
+			continue
+		}
+
+		res, err := tx.ExecContext(ctx,
+			"UPDATE objectives SET completed=FALSE, period_start=?, updated=? WHERE id=? AND period_start=?", rule.PeriodStart(now), now, o.Id, periodStart,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to reset objective %s: %w", o.Id, dbError(err))
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"INSERT INTO objective_completions (id, objective_id, period_start, completed, created) VALUES (?,?,?,?,?)",
+			uuid.New().String(), o.Id, periodStart, o.Completed, now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert completion of objective %s: %w", o.Id, dbError(err))
+		}
+
+		// an objective left open was already keeping its quest open, and quests broken down into a questline
+		// stay completed as long as it is
+		if !o.Completed {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE quests SET completed=FALSE, completed_at=NULL, updated=? WHERE id=? AND child_questline_id IS NULL", now, o.QuestId)
+		if err != nil {
+			return fmt.Errorf("failed to reset quest %s: %w", o.QuestId, dbError(err))
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE questlines SET updated=? WHERE id=?", now, questlineId); err != nil {
+		return fmt.Errorf("failed to update questline %s: %w", questlineId, dbError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit reset objectives transaction %s: %w", questlineId, dbError(err))
+	}
+	return nil
+}
+
+// GetObjectiveCompletions fetches the finished periods of a recurring objective, newest first
+func GetObjectiveCompletions(ctx context.Context, objectiveId string) ([]models.ObjectiveCompletion, error) {
+	rows, err := DB.QueryContext(ctx,
+		"SELECT id, period_start, completed, created FROM objective_completions WHERE objective_id=? ORDER BY period_start DESC", objectiveId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query completions of objective %s: %w", objectiveId, dbError(err))
+	}
+	defer rows.Close()
+
+	completions := make([]models.ObjectiveCompletion, 0)
+	for rows.Next() {
+		c := models.ObjectiveCompletion{ObjectiveId: objectiveId}
+		if err := rows.Scan(&c.Id, &c.PeriodStart, &c.Completed, &c.Created); err != nil {
+			return nil, fmt.Errorf("failed to scan completion of objective %s: %w", objectiveId, dbError(err))
+		}
+		completions = append(completions, c)
+	}
+	return completions, nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateShareLink stores a new hashed share link for a questline
+func CreateShareLink(ctx context.Context, link *models.ShareLink, tokenHash string) (*models.ShareLink, error) {
+	link.Id = uuid.New().String()
+	link.Created = time.Now()
+
+	_, err := DB.ExecContext(ctx,
+		"INSERT INTO share_links (id, questline_id, token_hash, redact_descriptions, created, expires) VALUES (?,?,?,?,?,?)",
+		link.Id, link.QuestlineId, tokenHash, link.RedactDescriptions, link.Created, link.Expires,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert share link %s: %w", link.Id, dbError(err))
+	}
+	return link, nil
+}
+
+// GetShareLinks fetches list of all share links of a questline
+func GetShareLinks(ctx context.Context, questlineId string) ([]models.ShareLink, error) {
+	rows, err := DB.QueryContext(ctx,
+		"SELECT id, redact_descriptions, created, expires FROM share_links WHERE questline_id=? ORDER BY created DESC", questlineId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share links for questline %s: %w", questlineId, dbError(err))
+	}
+	defer rows.Close()
+
+	links := make([]models.ShareLink, 0)
+	for rows.Next() {
+		link := models.ShareLink{QuestlineId: questlineId}
+		var expires sql.NullTime
+
+		if err := rows.Scan(&link.Id, &link.RedactDescriptions, &link.Created, &expires); err != nil {
+			return nil, fmt.Errorf("failed to scan share link for questline %s: %w", questlineId, dbError(err))
+		}
+		if expires.Valid {
+			link.Expires = &expires.Time
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// GetShareLinkByToken fetches an unexpired share link
+func GetShareLinkByToken(ctx context.Context, tokenHash string) (*models.ShareLink, error) {
+	var link models.ShareLink
+	var expires sql.NullTime
+
+	query := `
+		SELECT id, questline_id, redact_descriptions, created, expires
+		FROM share_links
+		WHERE token_hash=? AND (expires IS NULL OR expires > ?)
+	`
+	err := DB.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(
+		&link.Id, &link.QuestlineId, &link.RedactDescriptions, &link.Created, &expires,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share link: %w", dbError(err))
+	}
+	if expires.Valid {
+		link.Expires = &expires.Time
+	}
+	return &link, nil
+}
+
+// DeleteShareLink revokes a share link of a questline
+func DeleteShareLink(ctx context.Context, id string, questlineId string) error {
+	res, err := DB.ExecContext(ctx, "DELETE FROM share_links WHERE id=? AND questline_id=?", id, questlineId)
+	if err != nil {
+		return fmt.Errorf("failed to delete share link %s: %w", id, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to delete share link %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -1,11 +1,14 @@
 package db
 
 import (
+	"barrettotte/questlines/logging"
+	"barrettotte/questlines/metrics"
 	"barrettotte/questlines/models"
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
@@ -18,32 +21,39 @@ import (
 
 var DB *sql.DB
 
+// querier runs queries on the database or inside a transaction
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 // InitDB initializes SQLite db connection and runs database migrations
 func InitDB(dataSourceName string, migrationsDir string, embeddedMigrations embed.FS) error {
 	var err error
 	DB, err = sql.Open("sqlite3", dataSourceName)
+	dbPath = filePath(dataSourceName)
 
 	if err != nil {
-		return fmt.Errorf("failed to open database: %w", err)
+		return fmt.Errorf("failed to open database: %w", dbError(err))
 	}
 	if err = DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %w", err)
+		return fmt.Errorf("failed to ping database: %w", dbError(err))
 	}
 
 	// enable foreign keys
 	_, err = DB.Exec("PRAGMA foreign_keys = ON;")
 	if err != nil {
-		return fmt.Errorf("failed to enable foreign keys: %w", err)
+		return fmt.Errorf("failed to enable foreign keys: %w", dbError(err))
 	}
 
 	applyMigrations(migrationsDir, embeddedMigrations)
 
 	// verify db instance is still up
 	if err = DB.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database after applying migrations: %w", err)
+		return fmt.Errorf("failed to ping database after applying migrations: %w", dbError(err))
 	}
 
-	log.Println("Database initialized")
+	slog.Info("Database initialized")
 
 	return nil
 }
@@ -52,42 +62,58 @@ func InitDB(dataSourceName string, migrationsDir string, embeddedMigrations embe
 func applyMigrations(migrationsDir string, embeddedMigrations embed.FS) {
 	driver, err := sqlite3.WithInstance(DB, &sqlite3.Config{})
 	if err != nil {
-		log.Fatalf("Migration driver error: %v", err)
+		logging.Fatal("Migration driver error", "error", err)
 	}
 
 	srcDriver, err := iofs.New(embeddedMigrations, migrationsDir)
 	if err != nil {
-		log.Fatalf("Failed to open embedded migrations: %v", err)
+		logging.Fatal("Failed to open embedded migrations", "error", err)
+	}
+
+	// remember newest migration to tell if database is up to date
+	if latestMigration, err = srcDriver.First(); err != nil {
+		logging.Fatal("Failed to read embedded migrations", "error", err)
+	}
+	for {
+		next, err := srcDriver.Next(latestMigration)
+		if err != nil {
+			break
+		}
+		latestMigration = next
 	}
 
 	m, err := migrate.NewWithInstance("iofs", srcDriver, "sqlite3", driver)
 	if err != nil {
-		log.Fatalf("Migration init error: %v", err)
+		logging.Fatal("Migration init error", "error", err)
 	}
 
 	err = m.Up()
 	if err != nil {
 		if err != migrate.ErrNoChange {
-			log.Fatalf("Migration apply error: %v", err)
+			logging.Fatal("Migration apply error", "error", err)
 		}
-		log.Println("No migrations to apply.")
+		slog.Info("No migrations to apply")
 	}
-	log.Println("Migrations completed.")
+	slog.Info("Migrations completed")
 }
 
-// GetQuestlineInfos fetches list of all questlines
-func GetQuestlineInfos() ([]models.QuestlineInfo, error) {
+// GetQuestlineInfos fetches list of all questlines owned by or shared with a user
+func GetQuestlineInfos(ctx context.Context, userId string) ([]models.QuestlineInfo, error) {
 	query := `
 		SELECT ql.id, ql.name, ql.updated,
-		  (SELECT COUNT(*) FROM quests WHERE questline_id=ql.id) AS total_quests,
-		  (SELECT COUNT(*) FROM quests WHERE questline_id=ql.id AND completed=TRUE) AS completed_quests
+		  (SELECT COUNT(*) FROM quests WHERE questline_id=ql.id AND deleted_at IS NULL) AS total_quests,
+		  (SELECT COUNT(*) FROM quests WHERE questline_id=ql.id AND completed=TRUE AND deleted_at IS NULL) AS completed_quests,
+		  CASE WHEN ql.owner_id=?1 THEN 'owner' ELSE p.role END AS role,
+		  ql.owner_id IS NOT ?1 AS shared
 		FROM questlines AS ql
+		LEFT JOIN questline_permissions AS p ON p.questline_id=ql.id AND p.user_id=?1
+		WHERE (ql.owner_id=?1 OR p.user_id IS NOT NULL) AND ql.deleted_at IS NULL
 		ORDER BY ql.updated DESC
 	`
 
-	rows, err := DB.Query(query)
+	rows, err := DB.QueryContext(ctx, query, userId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query questlines: %w", err)
+		return nil, fmt.Errorf("failed to query questlines: %w", dbError(err))
 	}
 	defer rows.Close()
 
@@ -95,53 +121,137 @@ func GetQuestlineInfos() ([]models.QuestlineInfo, error) {
 	for rows.Next() {
 		var info models.QuestlineInfo
 
-		if err := rows.Scan(&info.Id, &info.Name, &info.Updated, &info.TotalQuests, &info.CompletedQuests); err != nil {
-			return nil, fmt.Errorf("failed to scan questline: %w", err)
+		err := rows.Scan(&info.Id, &info.Name, &info.Updated, &info.TotalQuests, &info.CompletedQuests, &info.Role, &info.Shared)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan questline: %w", dbError(err))
 		}
 		infos = append(infos, info)
 	}
 	return infos, nil
 }
 
+// columns of quests, objectives and dependencies read by their scan helpers.
+// Dependencies are selected from dependencyFrom, which only has the ones that are not in the trash
+const (
+	questColumns      = "q.id, q.title, q.description, q.pos_x, q.pos_y, q.color, q.completed, q.effort, q.due, q.completed_at, q.updated, COALESCE(q.child_questline_id, '')"
+	objectiveColumns  = "o.id, o.text, o.completed, o.sort_index, o.due, o.recurrence, o.period_start, o.updated"
+	dependencyColumns = "d.from_id, d.to_id, fq.questline_id, fql.name, fq.title, fq.completed, fq.completed_at"
+	dependencyFrom    = `
+		FROM dependencies AS d
+		JOIN quests AS fq ON fq.id=d.from_id
+		JOIN questlines AS fql ON fql.id=fq.questline_id
+		WHERE d.deleted_at IS NULL AND fq.deleted_at IS NULL AND fql.deleted_at IS NULL`
+)
+
+// helper for scanning a quest row selected with questColumns
+func scanQuest(row interface{ Scan(...any) error }, quest *models.Quest, dest ...any) error {
+	var due, completedAt, updated sql.NullTime
+	err := row.Scan(append(dest,
+		&quest.Id, &quest.Title, &quest.Description, &quest.Position.X, &quest.Position.Y, &quest.Color, &quest.Completed, &quest.Effort,
+		&due, &completedAt, &updated, &quest.ChildQuestlineId,
+	)...)
+	if err != nil {
+		return err
+	}
+	if due.Valid {
+		quest.Due = &due.Time
+	}
+	if completedAt.Valid {
+		quest.CompletedAt = &completedAt.Time
+	}
+	if updated.Valid {
+		quest.Updated = &updated.Time
+	}
+	return nil
+}
+
+// helper for scanning an objective row selected with objectiveColumns
+func scanObjective(row interface{ Scan(...any) error }, o *models.Objective, dest ...any) error {
+	var due, periodStart, updated sql.NullTime
+	if err := row.Scan(append(dest, &o.Id, &o.Text, &o.Completed, &o.SortIndex, &due, &o.Recurrence, &periodStart, &updated)...); err != nil {
+		return err
+	}
+	if due.Valid {
+		o.Due = &due.Time
+	}
+	if periodStart.Valid {
+		o.PeriodStart = &periodStart.Time
+	}
+	if updated.Valid {
+		o.Updated = &updated.Time
+	}
+	return nil
+}
+
+// helper for scanning a dependency row selected with dependencyColumns, from is the prerequisite it references
+func scanDependency(row interface{ Scan(...any) error }, dest ...any) (models.Dependency, models.ExternalQuestRef, error) {
+	var d models.Dependency
+	var from models.ExternalQuestRef
+	var completedAt sql.NullTime
+	if err := row.Scan(append(dest, &d.From, &d.To, &from.QuestlineId, &from.QuestlineName, &from.Title, &from.Completed, &completedAt)...); err != nil {
+		return d, from, err
+	}
+	if completedAt.Valid {
+		from.CompletedAt = &completedAt.Time
+	}
+	from.QuestId = d.From
+	return d, from, nil
+}
+
+// helper for adding a scanned dependency to a questline, as external if its prerequisite is in another questline
+func addDependency(questline *models.Questline, d models.Dependency, from models.ExternalQuestRef) {
+	if from.QuestlineId == questline.Id {
+		questline.Dependencies = append(questline.Dependencies, d)
+	} else {
+		questline.ExternalDependencies = append(questline.ExternalDependencies, models.ExternalDependency{From: from, To: d.To})
+	}
+}
+
 // GetQuestline fetches single questline with all data
-func GetQuestline(id string) (*models.Questline, error) {
+func GetQuestline(ctx context.Context, id string) (*models.Questline, error) {
+	return getQuestline(ctx, DB, id)
+}
+
+// fetches questline with all data using database or transaction, questlines and quests in the trash are left out
+func getQuestline(ctx context.Context, q querier, id string) (*models.Questline, error) {
+	start := time.Now()
+	defer metrics.ObserveQuery("GetQuestline", start)
 	var questline models.Questline
 
 	// fetch questline
-	err := DB.QueryRow("SELECT id, name, created, updated FROM questlines WHERE id=?", id).Scan(
-		&questline.Id, &questline.Name, &questline.Created, &questline.Updated,
+	err := q.QueryRowContext(ctx, "SELECT id, COALESCE(owner_id, ''), name, created, updated FROM questlines WHERE id=? AND deleted_at IS NULL", id).Scan(
+		&questline.Id, &questline.OwnerId, &questline.Name, &questline.Created, &questline.Updated,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query questline %s: %w", id, err)
+		return nil, fmt.Errorf("failed to query questline %s: %w", id, dbError(err))
 	}
 
 	// fetch quests of questline
-	questRows, err := DB.Query("SELECT id, title, description, pos_x, pos_y, color, completed FROM quests WHERE questline_id=?", id)
+	questRows, err := q.QueryContext(ctx, "SELECT "+questColumns+" FROM quests AS q WHERE q.questline_id=? AND q.deleted_at IS NULL", id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query quests for questline %s: %w", id, err)
+		return nil, fmt.Errorf("failed to query quests for questline %s: %w", id, dbError(err))
 	}
 	defer questRows.Close()
 
 	questline.Quests = make([]models.Quest, 0)
 	for questRows.Next() {
 		var quest models.Quest
-		err := questRows.Scan(&quest.Id, &quest.Title, &quest.Description, &quest.Position.X, &quest.Position.Y, &quest.Color, &quest.Completed)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan quest for questline %s: %w", id, err)
+		if err := scanQuest(questRows, &quest); err != nil {
+			return nil, fmt.Errorf("failed to scan quest for questline %s: %w", id, dbError(err))
 		}
 
 		// fetch objectives for quest
-		objectiveRows, err := DB.Query("SELECT id, text, completed, sort_index FROM objectives WHERE quest_id=? ORDER BY sort_index", quest.Id)
+		objectiveRows, err := q.QueryContext(ctx, "SELECT "+objectiveColumns+" FROM objectives AS o WHERE o.quest_id=? ORDER BY o.sort_index", quest.Id)
 		if err != nil {
-			return nil, fmt.Errorf("failed to query objectives for quest %s: %w", quest.Id, err)
+			return nil, fmt.Errorf("failed to query objectives for quest %s: %w", quest.Id, dbError(err))
 		}
 		defer objectiveRows.Close()
 
 		quest.Objectives = make([]models.Objective, 0)
 		for objectiveRows.Next() {
 			var o models.Objective
-			if err := objectiveRows.Scan(&o.Id, &o.Text, &o.Completed, &o.SortIndex); err != nil {
-				return nil, fmt.Errorf("failed to scan objective for quest %s: %w", o.Id, err)
+			if err := scanObjective(objectiveRows, &o); err != nil {
+				return nil, fmt.Errorf("failed to scan objective for quest %s: %w", quest.Id, dbError(err))
 			}
 			quest.Objectives = append(quest.Objectives, o)
 		}
@@ -149,140 +259,484 @@ func GetQuestline(id string) (*models.Questline, error) {
 		questline.Quests = append(questline.Quests, quest)
 	}
 
-	// fetch dependencies in questline
-	depRows, err := DB.Query("SELECT from_id, to_id FROM dependencies WHERE questline_id=?", id)
+	// fetch dependencies in questline, prerequisites in other questlines are read-only references
+	// and are hidden while they are in the trash
+	depRows, err := q.QueryContext(ctx, "SELECT "+dependencyColumns+dependencyFrom+" AND d.questline_id=?", id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query dependencies for questline %s: %w", id, err)
+		return nil, fmt.Errorf("failed to query dependencies for questline %s: %w", id, dbError(err))
 	}
 	defer depRows.Close()
 
 	questline.Dependencies = make([]models.Dependency, 0)
+	questline.ExternalDependencies = make([]models.ExternalDependency, 0)
 	for depRows.Next() {
-		var d models.Dependency
-		if err := depRows.Scan(&d.From, &d.To); err != nil {
-			return nil, fmt.Errorf("failed to scan dependency for questline %s: %w", id, err)
+		d, from, err := scanDependency(depRows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dependency for questline %s: %w", id, dbError(err))
 		}
-		questline.Dependencies = append(questline.Dependencies, d)
+		addDependency(&questline, d, from)
 	}
 
+	if questline.ChildQuestlines, err = getChildQuestlines(ctx, q, id); err != nil {
+		return nil, err
+	}
+	if err := fillStreaks(ctx, q, &questline); err != nil {
+		return nil, err
+	}
+	slog.DebugContext(ctx, "Loaded questline", "questline", id, "quests", len(questline.Quests), "duration", time.Since(start))
 	return &questline, nil
 }
 
+// questlines owned by or shared with user ?1, leaving out the trash
+const userQuestlines = `
+	SELECT ql.id FROM questlines AS ql
+	LEFT JOIN questline_permissions AS p ON p.questline_id=ql.id AND p.user_id=?1
+	WHERE (ql.owner_id=?1 OR p.user_id IS NOT NULL) AND ql.deleted_at IS NULL`
+
+// GetUserQuestlines fetches all questlines owned by or shared with a user with their quests, objectives and dependencies.
+// Each is loaded in one query across the questlines rather than per questline, child questlines are left out
+func GetUserQuestlines(ctx context.Context, userId string) ([]*models.Questline, error) {
+	start := time.Now()
+	defer metrics.ObserveQuery("GetUserQuestlines", start)
+
+	rows, err := DB.QueryContext(ctx,
+		"SELECT id, COALESCE(owner_id, ''), name, created, updated FROM questlines WHERE id IN ("+userQuestlines+") ORDER BY updated DESC", userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query questlines of user %s: %w", userId, dbError(err))
+	}
+	defer rows.Close()
+
+	questlines := make([]*models.Questline, 0)
+	byId := make(map[string]*models.Questline)
+	for rows.Next() {
+		ql := &models.Questline{
+			Quests:               make([]models.Quest, 0),
+			Dependencies:         make([]models.Dependency, 0),
+			ExternalDependencies: make([]models.ExternalDependency, 0),
+		}
+		if err := rows.Scan(&ql.Id, &ql.OwnerId, &ql.Name, &ql.Created, &ql.Updated); err != nil {
+			return nil, fmt.Errorf("failed to scan questline of user %s: %w", userId, dbError(err))
+		}
+		questlines = append(questlines, ql)
+		byId[ql.Id] = ql
+	}
+
+	questRows, err := DB.QueryContext(ctx,
+		"SELECT q.questline_id, "+questColumns+" FROM quests AS q WHERE q.questline_id IN ("+userQuestlines+") AND q.deleted_at IS NULL", userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quests of user %s: %w", userId, dbError(err))
+	}
+	defer questRows.Close()
+
+	for questRows.Next() {
+		var questlineId string
+		quest := models.Quest{Objectives: make([]models.Objective, 0)}
+		if err := scanQuest(questRows, &quest, &questlineId); err != nil {
+			return nil, fmt.Errorf("failed to scan quest of user %s: %w", userId, dbError(err))
+		}
+		if ql := byId[questlineId]; ql != nil {
+			ql.Quests = append(ql.Quests, quest)
+		}
+	}
+
+	// quests are only referenced once all are loaded, appending moves them
+	quests := make(map[string]*models.Quest)
+	for _, ql := range questlines {
+		for i := range ql.Quests {
+			quests[ql.Quests[i].Id] = &ql.Quests[i]
+		}
+	}
+
+	objectiveRows, err := DB.QueryContext(ctx, `
+		SELECT o.quest_id, `+objectiveColumns+`
+		FROM objectives AS o
+		JOIN quests AS q ON q.id=o.quest_id
+		WHERE q.questline_id IN (`+userQuestlines+`) AND q.deleted_at IS NULL
+		ORDER BY o.sort_index`, userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query objectives of user %s: %w", userId, dbError(err))
+	}
+	defer objectiveRows.Close()
+
+	for objectiveRows.Next() {
+		var questId string
+		var o models.Objective
+		if err := scanObjective(objectiveRows, &o, &questId); err != nil {
+			return nil, fmt.Errorf("failed to scan objective of user %s: %w", userId, dbError(err))
+		}
+		if quest := quests[questId]; quest != nil {
+			quest.Objectives = append(quest.Objectives, o)
+		}
+	}
+
+	depRows, err := DB.QueryContext(ctx, "SELECT d.questline_id, "+dependencyColumns+dependencyFrom+" AND d.questline_id IN ("+userQuestlines+")", userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dependencies of user %s: %w", userId, dbError(err))
+	}
+	defer depRows.Close()
+
+	for depRows.Next() {
+		var questlineId string
+		d, from, err := scanDependency(depRows, &questlineId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dependency of user %s: %w", userId, dbError(err))
+		}
+		if ql := byId[questlineId]; ql != nil {
+			addDependency(ql, d, from)
+		}
+	}
+
+	history, err := objectiveHistory(ctx, DB, "q.questline_id IN ("+userQuestlines+")", userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query objective completions of user %s: %w", userId, dbError(err))
+	}
+	for _, ql := range questlines {
+		applyStreaks(ql, history)
+	}
+	slog.DebugContext(ctx, "Loaded questlines of user", "user", userId, "questlines", len(questlines), "duration", time.Since(start))
+	return questlines, nil
+}
+
+// deletes rows selected by query whose IDs are not kept, delete query gets args followed by the ID
+func deleteMissing(ctx context.Context, tx *sql.Tx, selectQuery string, deleteQuery string, parentId string, keep map[string]bool, args ...any) error {
+	rows, err := tx.QueryContext(ctx, selectQuery, parentId)
+	if err != nil {
+		return err
+	}
+
+	toDelete := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		if !keep[id] {
+			toDelete = append(toDelete, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range toDelete {
+		if _, err := tx.ExecContext(ctx, deleteQuery, append(args, id)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // saveQuestline saves a questline
-func saveQuestline(tx *sql.Tx, questline *models.Questline, isUpdate bool) error {
+func saveQuestline(ctx context.Context, tx *sql.Tx, questline *models.Questline, isUpdate bool) error {
 	now := time.Now()
+	defer metrics.ObserveQuery("saveQuestline", now)
+
+	questIds := make(map[string]bool, len(questline.Quests))
+	objectiveIds := make(map[string]bool)
+	for _, q := range questline.Quests {
+		questIds[q.Id] = true
+		for _, o := range q.Objectives {
+			objectiveIds[o.Id] = true
+		}
+	}
 
 	if isUpdate {
-		_, err := tx.Exec("UPDATE questlines SET name=?, updated=? WHERE id=?", questline.Name, now, questline.Id)
+		res, err := tx.ExecContext(ctx, "UPDATE questlines SET name=?, updated=? WHERE id=? AND deleted_at IS NULL", questline.Name, now, questline.Id)
 		if err != nil {
-			return fmt.Errorf("failed to update questline %s: %w", questline.Id, err)
+			return fmt.Errorf("failed to update questline %s: %w", questline.Id, dbError(err))
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+			return fmt.Errorf("failed to update questline %s: %w", questline.Id, ErrNotFound)
 		}
 
-		// clear old quests (dependencies and objectives cascade deleted)
-		_, err = tx.Exec("DELETE FROM quests WHERE questline_id=?", questline.Id)
+		// quests are updated in place so dependencies from other questlines survive,
+		// only quests no longer in questline are moved to the trash along with their objectives
+		err = deleteMissing(ctx, tx,
+			"SELECT id FROM quests WHERE questline_id=? AND deleted_at IS NULL", "UPDATE quests SET deleted_at=? WHERE id=?", questline.Id, questIds, now,
+		)
 		if err != nil {
-			return fmt.Errorf("failed to delete old quests for questline %s: %w", questline.Id, err)
+			return fmt.Errorf("failed to delete old quests for questline %s: %w", questline.Id, dbError(err))
+		}
+
+		err = deleteMissing(ctx, tx,
+			"SELECT o.id FROM objectives AS o JOIN quests AS q ON q.id=o.quest_id WHERE q.questline_id=? AND q.deleted_at IS NULL",
+			"DELETE FROM objectives WHERE id=?", questline.Id, objectiveIds,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to delete old objectives for questline %s: %w", questline.Id, dbError(err))
+		}
+
+		// dependencies on quests in the trash go to the trash with them, the rest of the dependencies owned by questline are reinserted below
+		_, err = tx.ExecContext(ctx, `
+			UPDATE dependencies SET deleted_at=? WHERE questline_id=? AND deleted_at IS NULL AND EXISTS (
+				SELECT 1 FROM quests AS q JOIN questlines AS ql ON ql.id=q.questline_id
+				WHERE q.id IN (dependencies.from_id, dependencies.to_id) AND (q.deleted_at IS NOT NULL OR ql.deleted_at IS NOT NULL)
+			)`, now, questline.Id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to move dependencies of questline %s to trash: %w", questline.Id, dbError(err))
+		}
+		_, err = tx.ExecContext(ctx, "DELETE FROM dependencies WHERE questline_id=? AND deleted_at IS NULL", questline.Id)
+		if err != nil {
+			return fmt.Errorf("failed to delete old dependencies for questline %s: %w", questline.Id, dbError(err))
 		}
 	} else {
 		if questline.Id == "" || questline.Id == "null" {
 			questline.Id = uuid.New().String()
 		}
-		_, err := tx.Exec("INSERT INTO questlines (id, name, created, updated) VALUES (?,?,?,?)", questline.Id, questline.Name, now, now)
+		_, err := tx.ExecContext(ctx, "INSERT INTO questlines (id, owner_id, name, created, updated) VALUES (?,?,?,?,?)",
+			questline.Id, questline.OwnerId, questline.Name, now, now,
+		)
 		if err != nil {
-			return fmt.Errorf("failed to insert quest_line %s: %w", questline.Id, err)
+			return fmt.Errorf("failed to insert quest_line %s: %w", questline.Id, dbError(err))
 		}
 	}
 
-	// insert quests
-	questStmt, err := tx.Prepare("INSERT INTO quests (id, questline_id, title, description, pos_x, pos_y, color, completed) VALUES (?,?,?,?,?,?,?,?)")
+	// quests broken down into a questline are completed once all of its quests are
+	links := make(map[string]string)
+	if isUpdate {
+		var err error
+		if links, err = getQuestChildLinks(ctx, tx, questline.Id); err != nil {
+			return err
+		}
+	}
+	for i, q := range questline.Quests {
+		if q.ChildQuestlineId == "" {
+			continue
+		}
+		completed, err := childQuestlineCompleted(ctx, tx, questline.Id, q.ChildQuestlineId, links[q.Id] == q.ChildQuestlineId)
+		if err != nil {
+			return fmt.Errorf("failed to link quest %s to questline %s: %w", q.Id, q.ChildQuestlineId, err)
+		}
+		questline.Quests[i].Completed = completed
+	}
+
+	// upsert quests, refusing to take over quests of other questlines. Completion time is kept until reopened,
+	// the update time only moves when the quest changed and quests saved again are taken out of the trash
+	questStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO quests (id, questline_id, title, description, pos_x, pos_y, color, completed, effort, due, completed_at, updated, child_questline_id)
+		VALUES (?,?,?,?,?,?,?,?,?,?, CASE WHEN ? THEN ? END, ?, NULLIF(?, ''))
+		ON CONFLICT(id) DO UPDATE SET
+		  title=excluded.title, description=excluded.description, pos_x=excluded.pos_x, pos_y=excluded.pos_y,
+		  color=excluded.color, completed=excluded.completed, effort=excluded.effort, due=excluded.due, deleted_at=NULL,
+		  child_questline_id=excluded.child_questline_id,
+		  completed_at=CASE WHEN NOT excluded.completed THEN NULL WHEN quests.completed THEN quests.completed_at ELSE excluded.completed_at END,
+		  updated=CASE WHEN quests.updated IS NULL OR quests.deleted_at IS NOT NULL OR quests.title IS NOT excluded.title OR quests.description IS NOT excluded.description
+		    OR quests.pos_x IS NOT excluded.pos_x OR quests.pos_y IS NOT excluded.pos_y OR quests.color IS NOT excluded.color
+		    OR quests.completed IS NOT excluded.completed OR quests.effort IS NOT excluded.effort OR quests.due IS NOT excluded.due
+		    OR quests.child_questline_id IS NOT excluded.child_questline_id
+		    THEN excluded.updated ELSE quests.updated END
+		WHERE quests.questline_id=excluded.questline_id
+	`)
 	if err != nil {
-		return fmt.Errorf("failed to prepare quest insert statement: %w", err)
+		return fmt.Errorf("failed to prepare quest insert statement: %w", dbError(err))
 	}
 	defer questStmt.Close()
 
-	objectiveStmt, err := tx.Prepare("INSERT INTO objectives (id, quest_id, text, completed, sort_index) VALUES (?,?,?,?,?)")
+	// recurring objectives keep their current period unless their rule changed
+	objectiveStmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO objectives (id, quest_id, text, completed, sort_index, due, recurrence, period_start, updated) VALUES (?,?,?,?,?,?,?,?,?)
+		ON CONFLICT(id) DO UPDATE SET
+		  quest_id=excluded.quest_id, text=excluded.text, completed=excluded.completed, sort_index=excluded.sort_index, due=excluded.due,
+		  recurrence=excluded.recurrence,
+		  period_start=CASE WHEN objectives.recurrence=excluded.recurrence THEN objectives.period_start ELSE excluded.period_start END,
+		  updated=CASE WHEN objectives.updated IS NULL OR objectives.quest_id IS NOT excluded.quest_id OR objectives.text IS NOT excluded.text
+		    OR objectives.completed IS NOT excluded.completed OR objectives.sort_index IS NOT excluded.sort_index
+		    OR objectives.due IS NOT excluded.due OR objectives.recurrence IS NOT excluded.recurrence
+		    THEN excluded.updated ELSE objectives.updated END
+		WHERE objectives.quest_id IN (SELECT id FROM quests WHERE questline_id=?)
+	`)
 	if err != nil {
-		return fmt.Errorf("failed to prepare objective insert statement: %w", err)
+		return fmt.Errorf("failed to prepare objective insert statement: %w", dbError(err))
 	}
 	defer objectiveStmt.Close()
 
 	for _, q := range questline.Quests {
 		if q.Id == "" {
-			return fmt.Errorf("quest found with empty ID for quest_line %s", questline.Id)
+			return clientError(ErrValidation, "quest found with empty ID for quest_line %s", questline.Id)
 		}
 
-		_, err := questStmt.Exec(q.Id, questline.Id, q.Title, q.Description, q.Position.X, q.Position.Y, q.Color, q.Completed)
+		res, err := questStmt.ExecContext(ctx,
+			q.Id, questline.Id, q.Title, q.Description, q.Position.X, q.Position.Y, q.Color, q.Completed, q.Effort, q.Due, q.Completed, now, now, q.ChildQuestlineId,
+		)
 		if err != nil {
-			return fmt.Errorf("failed to insert quest %s for quest_line %s: %w", q.Id, questline.Id, err)
+			return fmt.Errorf("failed to insert quest %s for quest_line %s: %w", q.Id, questline.Id, dbError(err))
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+			return clientError(ErrConflict, "quest %s already belongs to another questline", q.Id)
 		}
 
 		if len(q.Objectives) > 0 {
 			for _, o := range q.Objectives {
 				if o.Id == "" {
-					return fmt.Errorf("objective found with empty ID for quest %s", q.Id)
+					return clientError(ErrValidation, "objective found with empty ID for quest %s", q.Id)
+				}
+				recurrence, periodStart, err := currentPeriod(o.Recurrence)
+				if err != nil {
+					return fmt.Errorf("failed to parse recurrence of objective %s: %w", o.Id, dbError(err))
 				}
-				_, err := objectiveStmt.Exec(o.Id, q.Id, o.Text, o.Completed, o.SortIndex)
+				res, err := objectiveStmt.ExecContext(ctx, o.Id, q.Id, o.Text, o.Completed, o.SortIndex, o.Due, recurrence, periodStart, now, questline.Id)
 				if err != nil {
-					return fmt.Errorf("failed to insert checklist item %s for quest %s: %w", o.Id, q.Id, err)
+					return fmt.Errorf("failed to insert checklist item %s for quest %s: %w", o.Id, q.Id, dbError(err))
+				}
+				if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+					return clientError(ErrConflict, "objective %s already belongs to another questline", o.Id)
 				}
 			}
 		}
 	}
 
 	// insert dependencies
-	if len(questline.Dependencies) > 0 {
-		depStmt, err := tx.Prepare("INSERT INTO dependencies (questline_id, from_id, to_id) VALUES (?,?,?)")
+	if len(questline.Dependencies) > 0 || len(questline.ExternalDependencies) > 0 {
+		depStmt, err := tx.PrepareContext(ctx,
+			"INSERT INTO dependencies (questline_id, from_id, to_id) VALUES (?,?,?) ON CONFLICT(questline_id, from_id, to_id) DO UPDATE SET deleted_at=NULL",
+		)
 		if err != nil {
-			return fmt.Errorf("failed to prepare dependency insert statement: %w", err)
+			return fmt.Errorf("failed to prepare dependency insert statement: %w", dbError(err))
 		}
 		defer depStmt.Close()
 
 		for _, d := range questline.Dependencies {
-			_, err := depStmt.Exec(questline.Id, d.From, d.To)
+			_, err := depStmt.ExecContext(ctx, questline.Id, d.From, d.To)
 			if err != nil {
-				return fmt.Errorf("failed to insert dependency for quest_line %s (from %s to %s): %w", questline.Id, d.From, d.To, err)
+				return fmt.Errorf("failed to insert dependency for quest_line %s (from %s to %s): %w", questline.Id, d.From, d.To, dbError(err))
+			}
+		}
+
+		// only the quest IDs of external prerequisites are saved, the rest of the reference is read-only
+		for _, d := range questline.ExternalDependencies {
+			if !questIds[d.To] {
+				return clientError(ErrValidation, "external dependency on %s targets quest %s outside of quest_line %s", d.From.QuestId, d.To, questline.Id)
+			}
+			if questIds[d.From.QuestId] {
+				return clientError(ErrValidation, "external dependency on %s is a quest in quest_line %s", d.From.QuestId, questline.Id)
+			}
+			_, err := depStmt.ExecContext(ctx, questline.Id, d.From.QuestId, d.To)
+			if err != nil {
+				return fmt.Errorf("failed to insert external dependency for quest_line %s (from %s to %s): %w", questline.Id, d.From.QuestId, d.To, dbError(err))
 			}
 		}
 	}
 
+	slog.DebugContext(ctx, "Saved questline",
+		"questline", questline.Id, "update", isUpdate, "quests", len(questline.Quests), "duration", time.Since(now),
+	)
 	return nil
 }
 
 // CreateQuestline creates new questline
-func CreateQuestline(questline *models.Questline) (*models.Questline, error) {
+func CreateQuestline(ctx context.Context, questline *models.Questline) (*models.Questline, error) {
 	questline.Id = uuid.New().String()
 
-	tx, err := DB.Begin()
+	tx, err := DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin create questline transaction %s: %w", questline.Id, err)
+		return nil, fmt.Errorf("failed to begin create questline transaction %s: %w", questline.Id, dbError(err))
 	}
-	if err := saveQuestline(tx, questline, false); err != nil {
+	if err := saveQuestline(ctx, tx, questline, false); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to save questline %s: %w", questline.Id, err)
+		return nil, fmt.Errorf("failed to save questline %s: %w", questline.Id, dbError(err))
 	}
 	tx.Commit()
-	return GetQuestline(questline.Id)
+	return GetQuestline(ctx, questline.Id)
 }
 
 // UpdateQuestline updates existing questline
-func UpdateQuestline(questline *models.Questline) (*models.Questline, error) {
-	tx, err := DB.Begin()
+func UpdateQuestline(ctx context.Context, questline *models.Questline) (*models.Questline, error) {
+	tx, err := DB.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin update questline transaction %s: %w", questline.Id, err)
+		return nil, fmt.Errorf("failed to begin update questline transaction %s: %w", questline.Id, dbError(err))
 	}
-	if err := saveQuestline(tx, questline, true); err != nil {
+	if err := saveQuestline(ctx, tx, questline, true); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("failed to save questline %s: %w", questline.Id, err)
+		return nil, fmt.Errorf("failed to save questline %s: %w", questline.Id, dbError(err))
 	}
 	tx.Commit()
-	return GetQuestline(questline.Id)
+	return GetQuestline(ctx, questline.Id)
+}
+
+// PatchQuestline loads, changes and saves a questline in one transaction so concurrent updates aren't lost in between.
+// Returns the questline before and after the change
+func PatchQuestline(ctx context.Context, id string, change func(before *models.Questline) (*models.Questline, error)) (*models.Questline, *models.Questline, error) {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin patch questline transaction %s: %w", id, dbError(err))
+	}
+	defer tx.Rollback()
+
+	before, err := getQuestline(ctx, tx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	patched, err := change(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	if patched.Id != id {
+		return nil, nil, clientError(ErrValidation, "patch changed ID of questline %s", id)
+	}
+
+	if err := saveQuestline(ctx, tx, patched, true); err != nil {
+		return nil, nil, fmt.Errorf("failed to save questline %s: %w", id, dbError(err))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit patch of questline %s: %w", id, dbError(err))
+	}
+
+	after, err := GetQuestline(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
 }
 
-// DeleteQuestline deletes questline
-func DeleteQuestline(id string) error {
-	_, err := DB.Exec("DELETE FROM questlines WHERE id=?", id)
+// DeleteQuestline moves questline to the trash
+func DeleteQuestline(ctx context.Context, id string) error {
+	res, err := DB.ExecContext(ctx, "UPDATE questlines SET deleted_at=? WHERE id=? AND deleted_at IS NULL", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete questline %s: %w", id, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to delete questline %s: %w", id, ErrNotFound)
+	}
+	slog.DebugContext(ctx, "Moved questline to trash", "questline", id)
+	return nil
+}
+
+// UpdateQuestPositions updates only the positions of quests in a questline
+func UpdateQuestPositions(ctx context.Context, questlineId string, quests []models.Quest) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin update positions transaction %s: %w", questlineId, dbError(err))
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.ExecContext(ctx, "UPDATE questlines SET updated=? WHERE id=? AND deleted_at IS NULL", now, questlineId)
 	if err != nil {
-		return fmt.Errorf("failed to delete questline %s: %w", id, err)
+		return fmt.Errorf("failed to update questline %s: %w", questlineId, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to update questline %s: %w", questlineId, ErrNotFound)
+	}
+
+	posStmt, err := tx.PrepareContext(ctx,
+		"UPDATE quests SET pos_x=?, pos_y=?, updated=CASE WHEN pos_x IS NOT ? OR pos_y IS NOT ? THEN ? ELSE updated END WHERE id=? AND questline_id=? AND deleted_at IS NULL",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to prepare quest position statement: %w", dbError(err))
+	}
+	defer posStmt.Close()
+
+	for _, q := range quests {
+		if _, err := posStmt.ExecContext(ctx, q.Position.X, q.Position.Y, q.Position.X, q.Position.Y, now, q.Id, questlineId); err != nil {
+			return fmt.Errorf("failed to update position of quest %s: %w", q.Id, dbError(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit quest positions for questline %s: %w", questlineId, dbError(err))
 	}
 	return nil
 }
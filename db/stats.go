@@ -0,0 +1,31 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Stats are totals across all questlines
+type Stats struct {
+	Questlines      int
+	Quests          int
+	CompletedQuests int
+}
+
+// GetStats counts questlines and quests of all users, leaving out the trash
+func GetStats(ctx context.Context) (*Stats, error) {
+	var stats Stats
+	err := DB.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM questlines WHERE deleted_at IS NULL),
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN q.completed THEN 1 ELSE 0 END), 0)
+		FROM quests AS q
+		JOIN questlines AS ql ON ql.id=q.questline_id
+		WHERE q.deleted_at IS NULL AND ql.deleted_at IS NULL
+	`).Scan(&stats.Questlines, &stats.Quests, &stats.CompletedQuests)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stats: %w", dbError(err))
+	}
+	return &stats, nil
+}
@@ -0,0 +1,192 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// copyQuestline deep copies a questline with fresh IDs for quests and objectives,
+// dependencies on quests in other questlines and links to child questlines are not copied
+func copyQuestline(src *models.Questline, resetProgress bool) *models.Questline {
+	dst := models.Questline{
+		Name:         src.Name,
+		Quests:       make([]models.Quest, 0, len(src.Quests)),
+		Dependencies: make([]models.Dependency, 0, len(src.Dependencies)),
+	}
+	questIds := make(map[string]string, len(src.Quests))
+
+	for _, q := range src.Quests {
+		copied := q
+		copied.Id = uuid.New().String()
+		copied.QuestlineId = ""
+		copied.ChildQuestlineId = "" // the new owner may not be able to view the child
+		questIds[q.Id] = copied.Id
+
+		copied.Objectives = make([]models.Objective, 0, len(q.Objectives))
+		for _, o := range q.Objectives {
+			copiedObj := o
+			copiedObj.Id = uuid.New().String()
+			copiedObj.QuestId = copied.Id
+			if resetProgress {
+				copiedObj.Completed = false
+			}
+			copied.Objectives = append(copied.Objectives, copiedObj)
+		}
+
+		if resetProgress {
+			copied.Completed = false
+		}
+		dst.Quests = append(dst.Quests, copied)
+	}
+
+	for _, d := range src.Dependencies {
+		from, fromOk := questIds[d.From]
+		to, toOk := questIds[d.To]
+		if !fromOk || !toOk {
+			continue // drop dependencies on quests outside of questline
+		}
+		dst.Dependencies = append(dst.Dependencies, models.Dependency{From: from, To: to})
+	}
+	return &dst
+}
+
+// CloneQuestline deep copies an existing questline into a new questline owned by a user
+func CloneQuestline(ctx context.Context, id string, ownerId string, name string, resetProgress bool) (*models.Questline, error) {
+	src, err := GetQuestline(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	cloned := copyQuestline(src, resetProgress)
+	cloned.OwnerId = ownerId
+	cloned.Name = name
+	if cloned.Name == "" {
+		cloned.Name = src.Name + " (copy)"
+	}
+	if errs := cloned.Validate(); len(errs) > 0 {
+		return nil, &InvalidError{Errors: errs}
+	}
+	return CreateQuestline(ctx, cloned)
+}
+
+// GetTemplateInfos fetches list of all templates, the library is shared by all users
+func GetTemplateInfos(ctx context.Context) ([]models.TemplateInfo, error) {
+	query := `
+		SELECT id, COALESCE(owner_id, ''), name, description, json_array_length(questline, '$.quests') AS total_quests, updated
+		FROM templates
+		ORDER BY name
+	`
+
+	rows, err := DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query templates: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	infos := make([]models.TemplateInfo, 0)
+	for rows.Next() {
+		var info models.TemplateInfo
+
+		if err := rows.Scan(&info.Id, &info.OwnerId, &info.Name, &info.Description, &info.TotalQuests, &info.Updated); err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", dbError(err))
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// GetTemplate fetches single template with its questline skeleton
+func GetTemplate(ctx context.Context, id string) (*models.Template, error) {
+	var template models.Template
+	var data string
+
+	err := DB.QueryRowContext(ctx, "SELECT id, COALESCE(owner_id, ''), name, description, questline, created, updated FROM templates WHERE id=?", id).Scan(
+		&template.Id, &template.OwnerId, &template.Name, &template.Description, &data, &template.Created, &template.Updated,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query template %s: %w", id, dbError(err))
+	}
+
+	if err := json.Unmarshal([]byte(data), &template.Questline); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal questline of template %s: %w", id, dbError(err))
+	}
+	return &template, nil
+}
+
+// CreateTemplate creates new template owned by template's owner, progress of its questline is always reset
+func CreateTemplate(ctx context.Context, template *models.Template) (*models.Template, error) {
+	template.Id = uuid.New().String()
+	skeleton := copyQuestline(&template.Questline, true)
+
+	if template.Name == "" {
+		template.Name = skeleton.Name
+	}
+	if skeleton.Name == "" {
+		skeleton.Name = template.Name
+	}
+
+	// skeleton is checked like any questline so every instantiation of it can be saved
+	if errs := (&models.Template{Name: template.Name, Description: template.Description, Questline: *skeleton}).Validate(); len(errs) > 0 {
+		return nil, &InvalidError{Errors: errs}
+	}
+
+	data, err := json.Marshal(skeleton)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal questline of template %s: %w", template.Id, dbError(err))
+	}
+
+	now := time.Now()
+	_, err = DB.ExecContext(ctx,
+		"INSERT INTO templates (id, owner_id, name, description, questline, created, updated) VALUES (?,?,?,?,?,?,?)",
+		template.Id, template.OwnerId, template.Name, template.Description, string(data), now, now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert template %s: %w", template.Id, dbError(err))
+	}
+	return GetTemplate(ctx, template.Id)
+}
+
+// CreateTemplateFromQuestline creates new template owned by a user from an existing questline
+func CreateTemplateFromQuestline(ctx context.Context, questlineId string, ownerId string, name string, description string) (*models.Template, error) {
+	ql, err := GetQuestline(ctx, questlineId)
+	if err != nil {
+		return nil, err
+	}
+	return CreateTemplate(ctx, &models.Template{OwnerId: ownerId, Name: name, Description: description, Questline: *ql})
+}
+
+// CreateQuestlineFromTemplate creates new questline owned by a user from a template's skeleton
+func CreateQuestlineFromTemplate(ctx context.Context, templateId string, ownerId string, name string) (*models.Questline, error) {
+	template, err := GetTemplate(ctx, templateId)
+	if err != nil {
+		return nil, err
+	}
+
+	ql := copyQuestline(&template.Questline, true)
+	ql.OwnerId = ownerId
+	ql.Name = name
+	if ql.Name == "" {
+		ql.Name = template.Name
+	}
+	if errs := ql.Validate(); len(errs) > 0 {
+		return nil, &InvalidError{Errors: errs}
+	}
+	return CreateQuestline(ctx, ql)
+}
+
+// DeleteTemplate deletes template owned by a user
+func DeleteTemplate(ctx context.Context, id string, ownerId string) error {
+	res, err := DB.ExecContext(ctx, "DELETE FROM templates WHERE id=? AND owner_id=?", id, ownerId)
+	if err != nil {
+		return fmt.Errorf("failed to delete template %s: %w", id, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to delete template %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CreateApiToken stores a new hashed API token for a user
+func CreateApiToken(ctx context.Context, token *models.ApiToken, tokenHash string) (*models.ApiToken, error) {
+	token.Id = uuid.New().String()
+	token.Created = time.Now()
+
+	_, err := DB.ExecContext(ctx,
+		"INSERT INTO api_tokens (id, user_id, name, token_hash, scope, created, expires) VALUES (?,?,?,?,?,?,?)",
+		token.Id, token.UserId, token.Name, tokenHash, token.Scope, token.Created, token.Expires,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert api token %s: %w", token.Id, dbError(err))
+	}
+	return token, nil
+}
+
+// GetApiTokens fetches list of all API tokens of a user
+func GetApiTokens(ctx context.Context, userId string) ([]models.ApiToken, error) {
+	rows, err := DB.QueryContext(ctx,
+		"SELECT id, name, scope, created, last_used, expires FROM api_tokens WHERE user_id=? ORDER BY created DESC", userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api tokens for user %s: %w", userId, dbError(err))
+	}
+	defer rows.Close()
+
+	tokens := make([]models.ApiToken, 0)
+	for rows.Next() {
+		t := models.ApiToken{UserId: userId}
+		var lastUsed, expires sql.NullTime
+
+		if err := rows.Scan(&t.Id, &t.Name, &t.Scope, &t.Created, &lastUsed, &expires); err != nil {
+			return nil, fmt.Errorf("failed to scan api token for user %s: %w", userId, dbError(err))
+		}
+		if lastUsed.Valid {
+			t.LastUsed = &lastUsed.Time
+		}
+		if expires.Valid {
+			t.Expires = &expires.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// GetApiTokenUser fetches the user and scope of an unexpired API token, marking it as used
+func GetApiTokenUser(ctx context.Context, tokenHash string) (*models.User, string, error) {
+	var user models.User
+	var tokenId string
+	var scope string
+	now := time.Now()
+
+	query := `
+		SELECT t.id, t.scope, u.id, u.username, u.created
+		FROM api_tokens AS t
+		JOIN users AS u ON u.id=t.user_id
+		WHERE t.token_hash=? AND (t.expires IS NULL OR t.expires > ?)
+	`
+	err := DB.QueryRowContext(ctx, query, tokenHash, now).Scan(&tokenId, &scope, &user.Id, &user.Username, &user.Created)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query api token: %w", dbError(err))
+	}
+
+	if _, err := DB.ExecContext(ctx, "UPDATE api_tokens SET last_used=? WHERE id=?", now, tokenId); err != nil {
+		return nil, "", fmt.Errorf("failed to update last use of api token %s: %w", tokenId, dbError(err))
+	}
+	return &user, scope, nil
+}
+
+// DeleteApiToken revokes an API token of a user
+func DeleteApiToken(ctx context.Context, id string, userId string) error {
+	res, err := DB.ExecContext(ctx, "DELETE FROM api_tokens WHERE id=? AND user_id=?", id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete api token %s: %w", id, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to delete api token %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// GetTrash fetches questlines in the trash owned by a user and quests in the trash of questlines they can edit
+func GetTrash(ctx context.Context, userId string) ([]models.TrashItem, error) {
+	query := `
+		SELECT 'questline', ql.id, ql.name, ql.id, ql.name, ql.deleted_at
+		FROM questlines AS ql
+		LEFT JOIN questline_permissions AS p ON p.questline_id=ql.id AND p.user_id=?1
+		WHERE ql.deleted_at IS NOT NULL AND (ql.owner_id=?1 OR p.role='owner')
+		UNION ALL
+		SELECT 'quest', q.id, q.title, ql.id, ql.name, q.deleted_at
+		FROM quests AS q
+		JOIN questlines AS ql ON ql.id=q.questline_id
+		LEFT JOIN questline_permissions AS p ON p.questline_id=ql.id AND p.user_id=?1
+		WHERE q.deleted_at IS NOT NULL AND ql.deleted_at IS NULL AND (ql.owner_id=?1 OR p.role IN ('editor', 'owner'))
+		ORDER BY 6 DESC
+	`
+	rows, err := DB.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trash: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	items := make([]models.TrashItem, 0)
+	for rows.Next() {
+		var item models.TrashItem
+		if err := rows.Scan(&item.Type, &item.Id, &item.Name, &item.QuestlineId, &item.QuestlineName, &item.DeletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan trash: %w", dbError(err))
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// GetDeletedQuestQuestline fetches the questline of a quest in the trash
+func GetDeletedQuestQuestline(ctx context.Context, questId string) (string, error) {
+	var questlineId string
+	err := DB.QueryRowContext(ctx, "SELECT questline_id FROM quests WHERE id=? AND deleted_at IS NOT NULL", questId).Scan(&questlineId)
+	if err != nil {
+		return "", fmt.Errorf("failed to query questline of deleted quest %s: %w", questId, dbError(err))
+	}
+	return questlineId, nil
+}
+
+// takes dependencies matching a condition out of the trash, once none of their quests or questlines are in it
+func restoreDependencies(ctx context.Context, tx *sql.Tx, condition string, args ...any) error {
+	query := `
+		UPDATE dependencies SET deleted_at=NULL
+		WHERE deleted_at IS NOT NULL AND (` + condition + `) AND NOT EXISTS (
+			SELECT 1 FROM quests AS q JOIN questlines AS ql ON ql.id=q.questline_id
+			WHERE q.id IN (dependencies.from_id, dependencies.to_id) AND (q.deleted_at IS NOT NULL OR ql.deleted_at IS NOT NULL)
+		)
+	`
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// RestoreQuestline takes a questline out of the trash, along with dependencies of other questlines on its quests
+func RestoreQuestline(ctx context.Context, id string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin restore questline transaction %s: %w", id, dbError(err))
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "UPDATE questlines SET deleted_at=NULL, updated=? WHERE id=? AND deleted_at IS NOT NULL", time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to restore questline %s: %w", id, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to restore questline %s: %w", id, ErrNotFound)
+	}
+	if err := restoreDependencies(ctx, tx, "from_id IN (SELECT id FROM quests WHERE questline_id=?)", id); err != nil {
+		return fmt.Errorf("failed to restore dependencies on questline %s: %w", id, dbError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit restore of questline %s: %w", id, dbError(err))
+	}
+	slog.DebugContext(ctx, "Restored questline", "questline", id)
+	return nil
+}
+
+// RestoreQuest takes a quest and its objectives and dependencies out of the trash
+func RestoreQuest(ctx context.Context, questlineId string, id string) error {
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin restore quest transaction %s: %w", id, dbError(err))
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.ExecContext(ctx,
+		"UPDATE quests SET deleted_at=NULL, updated=? WHERE id=? AND questline_id=? AND deleted_at IS NOT NULL", now, id, questlineId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to restore quest %s: %w", id, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to restore quest %s: %w", id, ErrNotFound)
+	}
+	if err := restoreDependencies(ctx, tx, "from_id=?1 OR to_id=?1", id); err != nil {
+		return fmt.Errorf("failed to restore dependencies of quest %s: %w", id, dbError(err))
+	}
+
+	// its child questline may have been broken down into this questline while the quest was in the trash
+	var childId sql.NullString
+	if err := tx.QueryRowContext(ctx, "SELECT child_questline_id FROM quests WHERE id=?", id).Scan(&childId); err != nil {
+		return fmt.Errorf("failed to query child questline of quest %s: %w", id, dbError(err))
+	}
+	if childId.Valid {
+		if err := checkChildCycle(ctx, tx, questlineId, childId.String); err != nil {
+			return fmt.Errorf("failed to restore quest %s: %w", id, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE questlines SET updated=? WHERE id=?", now, questlineId); err != nil {
+		return fmt.Errorf("failed to update questline %s: %w", questlineId, dbError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit restore of quest %s: %w", id, dbError(err))
+	}
+	slog.DebugContext(ctx, "Restored quest", "questline", questlineId, "quest", id)
+	return nil
+}
+
+// helper for deleting on one connection with foreign keys enabled, which is a setting of each connection
+// and needed for everything of a questline or quest to be cascade deleted
+func purge(ctx context.Context, query string, args ...any) (int64, error) {
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = ON;"); err != nil {
+		return 0, err
+	}
+	res, err := conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PurgeQuestline permanently deletes a questline in the trash
+func PurgeQuestline(ctx context.Context, id string) error {
+	affected, err := purge(ctx, "DELETE FROM questlines WHERE id=? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("failed to purge questline %s: %w", id, dbError(err))
+	}
+	if affected == 0 {
+		return fmt.Errorf("failed to purge questline %s: %w", id, ErrNotFound)
+	}
+	slog.DebugContext(ctx, "Purged questline", "questline", id)
+	return nil
+}
+
+// PurgeQuest permanently deletes a quest in the trash
+func PurgeQuest(ctx context.Context, questlineId string, id string) error {
+	affected, err := purge(ctx, "DELETE FROM quests WHERE id=? AND questline_id=? AND deleted_at IS NOT NULL", id, questlineId)
+	if err != nil {
+		return fmt.Errorf("failed to purge quest %s: %w", id, dbError(err))
+	}
+	if affected == 0 {
+		return fmt.Errorf("failed to purge quest %s: %w", id, ErrNotFound)
+	}
+	slog.DebugContext(ctx, "Purged quest", "questline", questlineId, "quest", id)
+	return nil
+}
+
+// PurgeTrash permanently deletes questlines and quests moved to the trash before a time.
+// Returns how many questlines and quests were purged
+func PurgeTrash(ctx context.Context, before time.Time) (int64, int64, error) {
+	questlines, err := purge(ctx, "DELETE FROM questlines WHERE deleted_at < ?", before)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to purge questlines: %w", dbError(err))
+	}
+	quests, err := purge(ctx, "DELETE FROM quests WHERE deleted_at < ?", before)
+	if err != nil {
+		return questlines, 0, fmt.Errorf("failed to purge quests: %w", dbError(err))
+	}
+	return questlines, quests, nil
+}
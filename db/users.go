@@ -0,0 +1,123 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUsernameTaken = fmt.Errorf("username already taken: %w", ErrConflict)
+
+// CountUsers counts registered users
+func CountUsers(ctx context.Context) (int, error) {
+	var count int
+	if err := DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", dbError(err))
+	}
+	return count, nil
+}
+
+// CreateUser creates new user, the first user claims questlines created before accounts existed
+func CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	user.Id = uuid.New().String()
+	user.Created = time.Now()
+
+	tx, err := DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin create user transaction %s: %w", user.Id, dbError(err))
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE username=?)", user.Username).Scan(&taken); err != nil {
+		return nil, fmt.Errorf("failed to check username %s: %w", user.Username, dbError(err))
+	}
+	if taken {
+		return nil, ErrUsernameTaken
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO users (id, username, password_hash, created) VALUES (?,?,?,?)",
+		user.Id, user.Username, user.PasswordHash, user.Created,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert user %s: %w", user.Id, dbError(err))
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", dbError(err))
+	}
+	if count == 1 {
+		if _, err := tx.ExecContext(ctx, "UPDATE questlines SET owner_id=? WHERE owner_id IS NULL", user.Id); err != nil {
+			return nil, fmt.Errorf("failed to claim unowned questlines for user %s: %w", user.Id, dbError(err))
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE templates SET owner_id=? WHERE owner_id IS NULL", user.Id); err != nil {
+			return nil, fmt.Errorf("failed to claim unowned templates for user %s: %w", user.Id, dbError(err))
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit user %s: %w", user.Id, dbError(err))
+	}
+	return user, nil
+}
+
+// GetUserByUsername fetches user including password hash
+func GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+
+	err := DB.QueryRowContext(ctx, "SELECT id, username, password_hash, created FROM users WHERE username=?", username).Scan(
+		&user.Id, &user.Username, &user.PasswordHash, &user.Created,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user %s: %w", username, dbError(err))
+	}
+	return &user, nil
+}
+
+// CreateSession stores a hashed session token for a user
+func CreateSession(ctx context.Context, userId string, tokenHash string, expires time.Time) error {
+	_, err := DB.ExecContext(ctx, "INSERT INTO sessions (token_hash, user_id, created, expires) VALUES (?,?,?,?)",
+		tokenHash, userId, time.Now(), expires,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert session for user %s: %w", userId, dbError(err))
+	}
+	return nil
+}
+
+// GetSessionUser fetches user of an unexpired session
+func GetSessionUser(ctx context.Context, tokenHash string) (*models.User, error) {
+	var user models.User
+
+	query := `
+		SELECT u.id, u.username, u.created
+		FROM sessions AS s
+		JOIN users AS u ON u.id=s.user_id
+		WHERE s.token_hash=? AND s.expires > ?
+	`
+	err := DB.QueryRowContext(ctx, query, tokenHash, time.Now()).Scan(&user.Id, &user.Username, &user.Created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session: %w", dbError(err))
+	}
+	return &user, nil
+}
+
+// DeleteSession deletes a session
+func DeleteSession(ctx context.Context, tokenHash string) error {
+	if _, err := DB.ExecContext(ctx, "DELETE FROM sessions WHERE token_hash=?", tokenHash); err != nil {
+		return fmt.Errorf("failed to delete session: %w", dbError(err))
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes all expired sessions
+func DeleteExpiredSessions(ctx context.Context) error {
+	if _, err := DB.ExecContext(ctx, "DELETE FROM sessions WHERE expires <= ?", time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %w", dbError(err))
+	}
+	return nil
+}
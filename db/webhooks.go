@@ -0,0 +1,239 @@
+package db
+
+import (
+	"barrettotte/questlines/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// max number of delivery attempts returned for a webhook
+const webhookDeliveryLimit = 100
+
+const webhookColumns = "id, user_id, COALESCE(questline_id,''), url, secret, events, created"
+
+func scanWebhook(row interface{ Scan(...any) error }) (*models.Webhook, error) {
+	var hook models.Webhook
+	var filter string
+
+	if err := row.Scan(&hook.Id, &hook.UserId, &hook.QuestlineId, &hook.Url, &hook.Secret, &filter, &hook.Created); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(filter), &hook.Events); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal events of webhook %s: %w", hook.Id, dbError(err))
+	}
+	return &hook, nil
+}
+
+func queryWebhooks(ctx context.Context, query string, args ...any) ([]models.Webhook, error) {
+	rows, err := DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, *hook)
+	}
+	return hooks, rows.Err()
+}
+
+// CreateWebhook stores a new webhook for a user
+func CreateWebhook(ctx context.Context, hook *models.Webhook) (*models.Webhook, error) {
+	hook.Id = uuid.New().String()
+	hook.Created = time.Now()
+	if hook.Events == nil {
+		hook.Events = make([]string, 0)
+	}
+
+	filter, err := json.Marshal(hook.Events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal events of webhook %s: %w", hook.Id, dbError(err))
+	}
+
+	var questlineId any
+	if hook.QuestlineId != "" {
+		questlineId = hook.QuestlineId
+	}
+
+	_, err = DB.ExecContext(ctx,
+		"INSERT INTO webhooks (id, user_id, questline_id, url, secret, events, created) VALUES (?,?,?,?,?,?,?)",
+		hook.Id, hook.UserId, questlineId, hook.Url, hook.Secret, string(filter), hook.Created,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert webhook %s: %w", hook.Id, dbError(err))
+	}
+	return hook, nil
+}
+
+// GetWebhooks fetches list of all webhooks of a user
+func GetWebhooks(ctx context.Context, userId string) ([]models.Webhook, error) {
+	hooks, err := queryWebhooks(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE user_id=? ORDER BY created DESC", userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks for user %s: %w", userId, dbError(err))
+	}
+	return hooks, nil
+}
+
+// GetWebhook fetches a webhook of a user
+func GetWebhook(ctx context.Context, id string, userId string) (*models.Webhook, error) {
+	row := DB.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id=? AND user_id=?", id, userId)
+	hook, err := scanWebhook(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook %s: %w", id, dbError(err))
+	}
+	return hook, nil
+}
+
+// GetQuestlineWebhooks fetches webhooks on a questline or on every questline of users that still have access to it.
+// Global webhooks of the user that made a change are always included, since the questline may no longer exist.
+func GetQuestlineWebhooks(ctx context.Context, questlineId string, userId string) ([]models.Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks AS w
+		WHERE (w.questline_id=?1 OR w.questline_id IS NULL) AND (
+			(w.questline_id IS NULL AND w.user_id=?2)
+			OR EXISTS (SELECT 1 FROM questlines AS q WHERE q.id=?1 AND q.owner_id=w.user_id)
+			OR EXISTS (SELECT 1 FROM questline_permissions AS p WHERE p.questline_id=?1 AND p.user_id=w.user_id)
+		)
+	`
+	hooks, err := queryWebhooks(ctx, query, questlineId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhooks for questline %s: %w", questlineId, dbError(err))
+	}
+	return hooks, nil
+}
+
+// DeleteWebhook deletes a webhook of a user and its delivery log
+func DeleteWebhook(ctx context.Context, id string, userId string) error {
+	res, err := DB.ExecContext(ctx, "DELETE FROM webhooks WHERE id=? AND user_id=?", id, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook %s: %w", id, dbError(err))
+	}
+	if affected, err := res.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("failed to delete webhook %s: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// QueueWebhookDelivery queues an event for delivery to a webhook
+func QueueWebhookDelivery(ctx context.Context, delivery *models.QueuedWebhookDelivery) error {
+	delivery.Id = uuid.New().String()
+	delivery.Created = time.Now()
+	if delivery.NextAttempt.IsZero() {
+		delivery.NextAttempt = delivery.Created
+	}
+
+	_, err := DB.ExecContext(ctx,
+		"INSERT INTO webhook_queue (id, webhook_id, event_id, event_type, payload, attempts, next_attempt, created) VALUES (?,?,?,?,?,?,?,?)",
+		delivery.Id, delivery.Webhook.Id, delivery.EventId, delivery.EventType, delivery.Payload, delivery.Attempts, delivery.NextAttempt, delivery.Created,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue delivery of webhook %s: %w", delivery.Webhook.Id, dbError(err))
+	}
+	return nil
+}
+
+// GetDueWebhookDeliveries fetches queued deliveries whose next attempt is due, oldest first
+func GetDueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.QueuedWebhookDelivery, error) {
+	query := `
+		SELECT d.id, d.event_id, d.event_type, d.payload, d.attempts, d.next_attempt, d.created,
+		  w.id, w.user_id, COALESCE(w.questline_id,''), w.url, w.secret, w.events, w.created
+		FROM webhook_queue AS d
+		JOIN webhooks AS w ON w.id=d.webhook_id
+		WHERE d.next_attempt <= ?
+		ORDER BY d.next_attempt, d.created
+		LIMIT ?
+	`
+	rows, err := DB.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queued webhook deliveries: %w", dbError(err))
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.QueuedWebhookDelivery, 0)
+	for rows.Next() {
+		var d models.QueuedWebhookDelivery
+		var filter string
+		err := rows.Scan(&d.Id, &d.EventId, &d.EventType, &d.Payload, &d.Attempts, &d.NextAttempt, &d.Created,
+			&d.Webhook.Id, &d.Webhook.UserId, &d.Webhook.QuestlineId, &d.Webhook.Url, &d.Webhook.Secret, &filter, &d.Webhook.Created,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan queued webhook delivery: %w", dbError(err))
+		}
+		if err := json.Unmarshal([]byte(filter), &d.Webhook.Events); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal events of webhook %s: %w", d.Webhook.Id, dbError(err))
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+// RescheduleWebhookDelivery records a failed attempt of a queued delivery and when to try again
+func RescheduleWebhookDelivery(ctx context.Context, id string, attempts int, nextAttempt time.Time) error {
+	_, err := DB.ExecContext(ctx, "UPDATE webhook_queue SET attempts=?, next_attempt=? WHERE id=?", attempts, nextAttempt, id)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule queued webhook delivery %s: %w", id, dbError(err))
+	}
+	return nil
+}
+
+// DeleteQueuedWebhookDelivery removes a delivery from the queue once it is done
+func DeleteQueuedWebhookDelivery(ctx context.Context, id string) error {
+	if _, err := DB.ExecContext(ctx, "DELETE FROM webhook_queue WHERE id=?", id); err != nil {
+		return fmt.Errorf("failed to delete queued webhook delivery %s: %w", id, dbError(err))
+	}
+	return nil
+}
+
+// CreateWebhookDelivery records a delivery attempt of a webhook
+func CreateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	delivery.Id = uuid.New().String()
+	delivery.Created = time.Now()
+
+	_, err := DB.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, attempt, payload, status_code, error, success, duration_ms, created)
+		VALUES (?,?,?,?,?,?,?,?,?,?,?)`,
+		delivery.Id, delivery.WebhookId, delivery.EventId, delivery.EventType, delivery.Attempt, delivery.Payload,
+		delivery.StatusCode, delivery.Error, delivery.Success, delivery.DurationMs, delivery.Created,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert delivery of webhook %s: %w", delivery.WebhookId, dbError(err))
+	}
+	return nil
+}
+
+// GetWebhookDeliveries fetches the most recent delivery attempts of a webhook
+func GetWebhookDeliveries(ctx context.Context, webhookId string) ([]models.WebhookDelivery, error) {
+	query := `
+		SELECT id, event_id, event_type, attempt, payload, status_code, error, success, duration_ms, created
+		FROM webhook_deliveries
+		WHERE webhook_id=?
+		ORDER BY created DESC
+		LIMIT ?
+	`
+	rows, err := DB.QueryContext(ctx, query, webhookId, webhookDeliveryLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deliveries of webhook %s: %w", webhookId, dbError(err))
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		d := models.WebhookDelivery{WebhookId: webhookId}
+		err := rows.Scan(&d.Id, &d.EventId, &d.EventType, &d.Attempt, &d.Payload, &d.StatusCode, &d.Error, &d.Success, &d.DurationMs, &d.Created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan delivery of webhook %s: %w", webhookId, dbError(err))
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,144 @@
+package digest
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/models"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// quests of one questline worth a reminder
+type QuestlineDigest struct {
+	QuestlineId string
+	Name        string
+	Overdue     []models.Quest
+	Unblocked   []models.Quest
+}
+
+type Digest struct {
+	Frequency  string
+	Since      time.Time // quests unblocked after this are new
+	Generated  time.Time
+	Questlines []QuestlineDigest
+}
+
+// IsEmpty checks if there is nothing to remind about
+func (d Digest) IsEmpty() bool {
+	return len(d.Questlines) == 0
+}
+
+// Counts totals overdue and newly unblocked quests across questlines
+func (d Digest) Counts() (int, int) {
+	overdue, unblocked := 0, 0
+	for _, ql := range d.Questlines {
+		overdue += len(ql.Overdue)
+		unblocked += len(ql.Unblocked)
+	}
+	return overdue, unblocked
+}
+
+// Subject summarizes digest for email subject
+func (d Digest) Subject() string {
+	overdue, unblocked := d.Counts()
+	return fmt.Sprintf("Questlines %s digest: %d overdue, %d newly unblocked", d.Frequency, overdue, unblocked)
+}
+
+// period a digest covers when it was never sent before
+func defaultSince(frequency string, now time.Time) time.Time {
+	if frequency == models.DigestWeekly {
+		return now.AddDate(0, 0, -7)
+	}
+	return now.AddDate(0, 0, -1)
+}
+
+// unblockedAt gets when the last prerequisite of each incomplete quest was completed.
+// Quests without prerequisites or with prerequisites of unknown completion time are left out.
+func unblockedAt(ql *models.Questline) map[string]time.Time {
+	completedAt := make(map[string]*time.Time)
+	completed := make(map[string]bool)
+	for _, q := range ql.Quests {
+		completedAt[q.Id] = q.CompletedAt
+		completed[q.Id] = q.Completed
+	}
+
+	prereqs := make(map[string][]*time.Time)
+	blocked := make(map[string]bool)
+	for _, d := range ql.Dependencies {
+		prereqs[d.To] = append(prereqs[d.To], completedAt[d.From])
+		blocked[d.To] = blocked[d.To] || !completed[d.From]
+	}
+	for _, d := range ql.ExternalDependencies {
+		prereqs[d.To] = append(prereqs[d.To], d.From.CompletedAt)
+		blocked[d.To] = blocked[d.To] || !d.From.Completed
+	}
+
+	unblocked := make(map[string]time.Time)
+	for _, q := range ql.Quests {
+		if q.Completed || blocked[q.Id] || len(prereqs[q.Id]) == 0 {
+			continue
+		}
+		var latest time.Time
+		known := true
+		for _, t := range prereqs[q.Id] {
+			if t == nil {
+				known = false
+				break
+			}
+			if t.After(latest) {
+				latest = *t
+			}
+		}
+		if known {
+			unblocked[q.Id] = latest
+		}
+	}
+	return unblocked
+}
+
+// Build collects overdue and newly unblocked quests of every questline a user can access
+func Build(ctx context.Context, sub models.DigestSubscription, now time.Time) (*Digest, error) {
+	digest := Digest{
+		Frequency:  sub.Frequency,
+		Since:      defaultSince(sub.Frequency, now),
+		Generated:  now,
+		Questlines: make([]QuestlineDigest, 0),
+	}
+	if sub.LastSent != nil {
+		digest.Since = *sub.LastSent
+	}
+
+	infos, err := db.GetQuestlineInfos(ctx, sub.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		ql, err := db.GetQuestline(ctx, info.Id)
+		if err != nil {
+			return nil, err
+		}
+		section := QuestlineDigest{QuestlineId: ql.Id, Name: ql.Name}
+		unblocked := unblockedAt(ql)
+
+		for _, q := range ql.Quests {
+			if !q.Completed && q.Due != nil && q.Due.Before(now) {
+				section.Overdue = append(section.Overdue, q)
+			}
+			if at, ok := unblocked[q.Id]; ok && at.After(digest.Since) {
+				section.Unblocked = append(section.Unblocked, q)
+			}
+		}
+		if len(section.Overdue) == 0 && len(section.Unblocked) == 0 {
+			continue
+		}
+
+		// most overdue first
+		sort.Slice(section.Overdue, func(i, j int) bool { return section.Overdue[i].Due.Before(*section.Overdue[j].Due) })
+		sort.Slice(section.Unblocked, func(i, j int) bool { return section.Unblocked[i].Title < section.Unblocked[j].Title })
+
+		digest.Questlines = append(digest.Questlines, section)
+	}
+	return &digest, nil
+}
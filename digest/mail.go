@@ -0,0 +1,158 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	texttemplate "text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var templateFuncs = map[string]any{
+	"formatDate": func(t *time.Time) string { return t.In(time.Local).Format("Mon Jan 2, 2006") },
+	"formatTime": func(t time.Time) string { return t.In(time.Local).Format("Mon Jan 2, 2006 15:04 MST") },
+}
+
+var (
+	textTemplate = texttemplate.Must(texttemplate.New("digest.txt.tmpl").Funcs(templateFuncs).ParseFS(templateFS, "templates/digest.txt.tmpl"))
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("digest.html.tmpl").Funcs(templateFuncs).ParseFS(templateFS, "templates/digest.html.tmpl"))
+)
+
+// SMTP server digests are sent through
+type Config struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// ConfigFromEnv reads SMTP config from SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     25,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if port := os.Getenv("SMTP_PORT"); port != "" {
+		parsed, err := strconv.Atoi(port)
+		if err != nil {
+			return config, fmt.Errorf("invalid SMTP_PORT %s: %w", port, err)
+		}
+		config.Port = parsed
+	}
+	if config.From == "" {
+		config.From = "questlines@localhost"
+	}
+	return config, nil
+}
+
+// Enabled checks if an SMTP server is configured
+func (c Config) Enabled() bool {
+	return c.Host != ""
+}
+
+// Render renders plain text and HTML versions of a digest
+func Render(d *Digest) (string, string, error) {
+	var text, html bytes.Buffer
+
+	if err := textTemplate.Execute(&text, d); err != nil {
+		return "", "", fmt.Errorf("failed to render text digest: %w", err)
+	}
+	if err := htmlTemplate.Execute(&html, d); err != nil {
+		return "", "", fmt.Errorf("failed to render html digest: %w", err)
+	}
+	return text.String(), html.String(), nil
+}
+
+// Send renders and emails a digest as a multipart message with plain text and HTML alternatives
+func Send(config Config, to string, d *Digest) error {
+	text, html, err := Render(d)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", html},
+	} {
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create digest message part: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return fmt.Errorf("failed to write digest message part: %w", err)
+		}
+		qp.Close()
+	}
+	writer.Close()
+
+	header := textproto.MIMEHeader{"Content-Type": {"multipart/alternative; boundary=" + writer.Boundary()}}
+	if err := sendMail(config, to, d.Subject(), d.Generated, header, body.Bytes()); err != nil {
+		return fmt.Errorf("failed to send digest to %s: %w", to, err)
+	}
+	return nil
+}
+
+// SendConfirmation emails the code that confirms an address before digests are sent to it
+func SendConfirmation(config Config, to string, code string) error {
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	fmt.Fprintf(qp, "Confirm this address for Questlines digests with the code:\r\n\r\n%s\r\n\r\n", code)
+	fmt.Fprintf(qp, "If you did not subscribe to digests, ignore this email.\r\n")
+	qp.Close()
+
+	header := textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+	if err := sendMail(config, to, "Confirm your Questlines digest", time.Now(), header, body.Bytes()); err != nil {
+		return fmt.Errorf("failed to send digest confirmation to %s: %w", to, err)
+	}
+	return nil
+}
+
+// helper for writing headers of a message and sending it through the SMTP server
+func sendMail(config Config, to string, subject string, date time.Time, header textproto.MIMEHeader, body []byte) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if value := header.Get(key); value != "" {
+			fmt.Fprintf(&msg, "%s: %s\r\n", key, value)
+		}
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body)
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
+	return smtp.SendMail(addr, auth, config.From, []string{to}, msg.Bytes())
+}
@@ -0,0 +1,215 @@
+package events
+
+import (
+	"barrettotte/questlines/models"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	QuestlineCreated   = "questline.created"
+	QuestlineUpdated   = "questline.updated"
+	QuestlineDeleted   = "questline.deleted"
+	QuestlineCompleted = "questline.completed"
+	QuestCreated       = "quest.created"
+	QuestUpdated       = "quest.updated"
+	QuestDeleted       = "quest.deleted"
+	QuestCompleted     = "quest.completed"
+	QuestReopened      = "quest.reopened"
+	ObjectiveCreated   = "objective.created"
+	ObjectiveUpdated   = "objective.updated"
+	ObjectiveDeleted   = "objective.deleted"
+	DependencyCreated  = "dependency.created"
+	DependencyDeleted  = "dependency.deleted"
+)
+
+// change made to a questline
+type Event struct {
+	Id          string             `json:"id"`
+	Type        string             `json:"type"`
+	QuestlineId string             `json:"questlineId"`
+	Name        string             `json:"name,omitempty"`    // questline name for questline events
+	QuestId     string             `json:"questId,omitempty"` // parent quest for objective events
+	Quest       *models.Quest      `json:"quest,omitempty"`
+	Objective   *models.Objective  `json:"objective,omitempty"`
+	Dependency  *models.Dependency `json:"dependency,omitempty"`
+	UserId      string             `json:"userId,omitempty"` // user that made the change
+	Origin      string             `json:"origin,omitempty"` // client that made the change
+	Time        time.Time          `json:"time"`
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("Event{Id: '%v', Type: '%v', QuestlineId: '%v', UserId: '%v', Origin: '%v', Time: %v}",
+		e.Id, e.Type, e.QuestlineId, e.UserId, e.Origin, e.Time.Format(time.RFC3339),
+	)
+}
+
+func newEvent(eventType string, questlineId string) Event {
+	return Event{Id: uuid.New().String(), Type: eventType, QuestlineId: questlineId, Time: time.Now()}
+}
+
+func isFinished(ql *models.Questline) bool {
+	if ql == nil || len(ql.Quests) == 0 {
+		return false
+	}
+	for _, q := range ql.Quests {
+		if !q.Completed {
+			return false
+		}
+	}
+	return true
+}
+
+func sameTime(a *time.Time, b *time.Time) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && a.Equal(*b))
+}
+
+// quest fields other than objectives and completion changed
+func questChanged(a models.Quest, b models.Quest) bool {
+	return a.Title != b.Title || a.Description != b.Description || a.Position != b.Position ||
+		a.Color != b.Color || a.Effort != b.Effort || !sameTime(a.Due, b.Due) || a.ChildQuestlineId != b.ChildQuestlineId
+}
+
+// Diff builds the events needed to go from one version of a questline to another.
+// A nil before means the questline was created and a nil after means it was deleted.
+func Diff(before *models.Questline, after *models.Questline) []Event {
+	changes := make([]Event, 0)
+
+	switch {
+	case before == nil && after == nil:
+		return changes
+	case after == nil:
+		e := newEvent(QuestlineDeleted, before.Id)
+		e.Name = before.Name
+		return append(changes, e)
+	case before == nil:
+		e := newEvent(QuestlineCreated, after.Id)
+		e.Name = after.Name
+		changes = append(changes, e)
+		before = &models.Questline{Id: after.Id}
+	case before.Name != after.Name:
+		e := newEvent(QuestlineUpdated, after.Id)
+		e.Name = after.Name
+		changes = append(changes, e)
+	}
+
+	oldQuests := make(map[string]models.Quest, len(before.Quests))
+	for _, q := range before.Quests {
+		oldQuests[q.Id] = q
+	}
+	newQuests := make(map[string]bool, len(after.Quests))
+
+	for i := range after.Quests {
+		q := after.Quests[i]
+		newQuests[q.Id] = true
+		old, existed := oldQuests[q.Id]
+
+		if !existed {
+			e := newEvent(QuestCreated, after.Id)
+			e.Quest = &q
+			changes = append(changes, e)
+		} else if questChanged(old, q) {
+			e := newEvent(QuestUpdated, after.Id)
+			e.Quest = &q
+			changes = append(changes, e)
+		}
+		changes = append(changes, diffObjectives(after.Id, q.Id, old.Objectives, q.Objectives)...)
+
+		if q.Completed && !old.Completed {
+			e := newEvent(QuestCompleted, after.Id)
+			e.Quest = &q
+			changes = append(changes, e)
+		} else if !q.Completed && old.Completed {
+			e := newEvent(QuestReopened, after.Id)
+			e.Quest = &q
+			changes = append(changes, e)
+		}
+	}
+
+	for i := range before.Quests {
+		if q := before.Quests[i]; !newQuests[q.Id] {
+			e := newEvent(QuestDeleted, after.Id)
+			e.Quest = &q
+			changes = append(changes, e)
+		}
+	}
+
+	changes = append(changes, diffDependencies(after.Id, before.Dependencies, after.Dependencies)...)
+
+	if isFinished(after) && !isFinished(before) {
+		e := newEvent(QuestlineCompleted, after.Id)
+		e.Name = after.Name
+		changes = append(changes, e)
+	}
+	return changes
+}
+
+func diffObjectives(questlineId string, questId string, before []models.Objective, after []models.Objective) []Event {
+	changes := make([]Event, 0)
+
+	old := make(map[string]models.Objective, len(before))
+	for _, o := range before {
+		old[o.Id] = o
+	}
+	kept := make(map[string]bool, len(after))
+
+	for i := range after {
+		o := after[i]
+		kept[o.Id] = true
+
+		prev, existed := old[o.Id]
+		eventType := ObjectiveUpdated
+		if !existed {
+			eventType = ObjectiveCreated
+		} else if prev.Text == o.Text && prev.Completed == o.Completed && prev.SortIndex == o.SortIndex && prev.Recurrence == o.Recurrence &&
+			sameTime(prev.Due, o.Due) {
+			continue
+		}
+		e := newEvent(eventType, questlineId)
+		e.QuestId = questId
+		e.Objective = &o
+		changes = append(changes, e)
+	}
+
+	for i := range before {
+		if o := before[i]; !kept[o.Id] {
+			e := newEvent(ObjectiveDeleted, questlineId)
+			e.QuestId = questId
+			e.Objective = &o
+			changes = append(changes, e)
+		}
+	}
+	return changes
+}
+
+func diffDependencies(questlineId string, before []models.Dependency, after []models.Dependency) []Event {
+	changes := make([]Event, 0)
+
+	key := func(d models.Dependency) string { return d.From + "->" + d.To }
+	old := make(map[string]bool, len(before))
+	for _, d := range before {
+		old[key(d)] = true
+	}
+	kept := make(map[string]bool, len(after))
+
+	for i := range after {
+		d := after[i]
+		kept[key(d)] = true
+		if !old[key(d)] {
+			e := newEvent(DependencyCreated, questlineId)
+			e.Dependency = &d
+			changes = append(changes, e)
+		}
+	}
+
+	for i := range before {
+		if d := before[i]; !kept[key(d)] {
+			e := newEvent(DependencyDeleted, questlineId)
+			e.Dependency = &d
+			changes = append(changes, e)
+		}
+	}
+	return changes
+}
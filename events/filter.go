@@ -0,0 +1,40 @@
+package events
+
+import "strings"
+
+// every event type that can be published
+var Types = []string{
+	QuestlineCreated, QuestlineUpdated, QuestlineDeleted, QuestlineCompleted,
+	QuestCreated, QuestUpdated, QuestDeleted, QuestCompleted, QuestReopened,
+	ObjectiveCreated, ObjectiveUpdated, ObjectiveDeleted,
+	DependencyCreated, DependencyDeleted,
+}
+
+// IsValidPattern checks if a filter pattern is "*", an event type, or a group of event types like "quest.*"
+func IsValidPattern(pattern string) bool {
+	if pattern == "*" {
+		return true
+	}
+	for _, t := range Types {
+		if t == pattern || strings.HasSuffix(pattern, ".*") && strings.HasPrefix(t, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches checks if an event type matches any filter pattern, an empty filter matches everything
+func Matches(filter []string, eventType string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, pattern := range filter {
+		if pattern == "*" || pattern == eventType {
+			return true
+		}
+		if strings.HasSuffix(pattern, ".*") && strings.HasPrefix(eventType, strings.TrimSuffix(pattern, "*")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// how many events a slow subscriber can fall behind before events are dropped
+const subscriberBuffer = 256
+
+// AllQuestlines subscribes to events of every questline
+const AllQuestlines = ""
+
+// Sink receives every published event before subscribers do. Unlike subscribers, events are never dropped for a sink
+type Sink func(events []Event)
+
+// Hub fans published events out to subscribers of a questline
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan Event]struct{}
+	sinks       []Sink
+}
+
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[string]map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events for a questline and a function to stop receiving them
+func (h *Hub) Subscribe(questlineId string) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[questlineId] == nil {
+		h.subscribers[questlineId] = make(map[chan Event]struct{})
+	}
+	h.subscribers[questlineId][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[questlineId], ch)
+			if len(h.subscribers[questlineId]) == 0 {
+				delete(h.subscribers, questlineId)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, unsubscribe
+}
+
+// AddSink adds a sink that receives every published event
+func (h *Hub) AddSink(sink Sink) {
+	h.mu.Lock()
+	h.sinks = append(h.sinks, sink)
+	h.mu.Unlock()
+}
+
+// Publish hands events to sinks, then sends them to subscribers of their questline and to subscribers of all questlines.
+// Publishing only waits on sinks, events are dropped for subscribers that are too far behind.
+func (h *Hub) Publish(events ...Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	sinks := h.sinks
+	h.mu.RUnlock()
+	for _, sink := range sinks {
+		sink(events)
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, e := range events {
+		for _, key := range []string{e.QuestlineId, AllQuestlines} {
+			for ch := range h.subscribers[key] {
+				select {
+				case ch <- e:
+				default:
+					slog.Warn("Dropped event for slow subscriber", "event", e.Type, "questline", e.QuestlineId)
+				}
+			}
+		}
+	}
+}
+
+// default hub used by the server
+var hub = NewHub()
+
+// Subscribe subscribes to events of a questline on the default hub
+func Subscribe(questlineId string) (<-chan Event, func()) {
+	return hub.Subscribe(questlineId)
+}
+
+// AddSink adds a sink to the default hub
+func AddSink(sink Sink) {
+	hub.AddSink(sink)
+}
+
+// Publish publishes events on the default hub
+func Publish(events ...Event) {
+	hub.Publish(events...)
+}
@@ -0,0 +1,294 @@
+package events
+
+import (
+	"barrettotte/questlines/models"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	ResolvedClient = "client"
+	ResolvedServer = "server"
+)
+
+var ErrInvalidChange = errors.New("invalid change")
+
+// Conflict is an offline change to something that was also changed on the server since the last sync
+type Conflict struct {
+	Change     int        `json:"change"` // index in change log
+	Type       string     `json:"type"`
+	EntityId   string     `json:"entityId"`
+	Resolution string     `json:"resolution"` // side whose change was kept
+	Reason     string     `json:"reason"`
+	ServerTime *time.Time `json:"serverTime,omitempty"` // when the server copy last changed
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("Conflict{Change: %d, Type: '%v', EntityId: '%v', Resolution: '%v', Reason: '%v'}",
+		c.Change, c.Type, c.EntityId, c.Resolution, c.Reason,
+	)
+}
+
+// merges a change log into a copy of the server questline
+type merger struct {
+	merged    *models.Questline
+	since     time.Time
+	applied   int
+	conflicts []Conflict
+}
+
+// Merge applies a change log recorded offline since the last sync to the server copy of a questline, in order of time.
+// Changes to quests and objectives also changed on the server since then are conflicts, the newer change wins.
+// Returns the merged copy, how many changes were applied and the conflicts
+func Merge(server *models.Questline, since time.Time, changes []Event) (*models.Questline, int, []Conflict, error) {
+	m := &merger{merged: server.Clone(), since: since, conflicts: make([]Conflict, 0)}
+
+	order := make([]int, len(changes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return changes[order[a]].Time.Before(changes[order[b]].Time)
+	})
+
+	touched := make(map[string]bool)
+	for _, i := range order {
+		e := changes[i]
+		if e.QuestlineId != "" && e.QuestlineId != server.Id {
+			return nil, 0, nil, fmt.Errorf("change %d is for questline %s: %w", i, e.QuestlineId, ErrInvalidChange)
+		}
+		if err := m.apply(i, e); err != nil {
+			return nil, 0, nil, fmt.Errorf("change %d (%s): %w", i, e.Type, err)
+		}
+		if e.QuestId != "" {
+			touched[e.QuestId] = true
+		}
+	}
+
+	for i := range m.merged.Quests {
+		if touched[m.merged.Quests[i].Id] {
+			fixSortIndexes(&m.merged.Quests[i])
+		}
+	}
+	return m.merged, m.applied, m.conflicts, nil
+}
+
+// resolve decides if a change is applied, recording a conflict if the server copy changed since the last sync
+func (m *merger) resolve(i int, e Event, entityId string, serverTime *time.Time) bool {
+	if serverTime == nil || !serverTime.After(m.since) {
+		m.applied++
+		return true
+	}
+
+	conflict := Conflict{Change: i, Type: e.Type, EntityId: entityId, Resolution: ResolvedServer, ServerTime: serverTime,
+		Reason: "changed on server after the change was made",
+	}
+	if e.Time.After(*serverTime) {
+		conflict.Resolution = ResolvedClient
+		conflict.Reason = "changed on server before the change was made"
+		m.applied++
+	}
+	m.conflicts = append(m.conflicts, conflict)
+	return conflict.Resolution == ResolvedClient
+}
+
+// helper for changes to things deleted on the server, which stay deleted
+func (m *merger) deleted(i int, e Event, entityId string) {
+	m.conflicts = append(m.conflicts, Conflict{
+		Change: i, Type: e.Type, EntityId: entityId, Resolution: ResolvedServer, Reason: "deleted on server",
+	})
+}
+
+func (m *merger) findQuest(questId string) *models.Quest {
+	if i := slices.IndexFunc(m.merged.Quests, func(q models.Quest) bool { return q.Id == questId }); i >= 0 {
+		return &m.merged.Quests[i]
+	}
+	return nil
+}
+
+// finds the quest an objective belongs to in any quest and its index there
+func (m *merger) findObjective(objectiveId string) (*models.Quest, int) {
+	for i := range m.merged.Quests {
+		quest := &m.merged.Quests[i]
+		if j := slices.IndexFunc(quest.Objectives, func(o models.Objective) bool { return o.Id == objectiveId }); j >= 0 {
+			return quest, j
+		}
+	}
+	return nil, -1
+}
+
+// objective fields other than the quest it belongs to changed
+func objectiveChanged(a models.Objective, b models.Objective) bool {
+	return a.Text != b.Text || a.Completed != b.Completed || a.SortIndex != b.SortIndex || a.Recurrence != b.Recurrence ||
+		!sameTime(a.Due, b.Due)
+}
+
+func (m *merger) apply(i int, e Event) error {
+	switch e.Type {
+	case QuestlineUpdated:
+		if e.Name != m.merged.Name && m.resolve(i, e, m.merged.Id, &m.merged.Updated) {
+			m.merged.Name = e.Name
+		}
+
+	case QuestlineCreated, QuestlineCompleted:
+		// derived from the other changes
+
+	case QuestCreated, QuestUpdated, QuestCompleted, QuestReopened, QuestDeleted:
+		if e.Quest == nil {
+			return fmt.Errorf("quest is required: %w", ErrInvalidChange)
+		}
+		m.applyQuest(i, e)
+
+	case ObjectiveCreated, ObjectiveUpdated, ObjectiveDeleted:
+		if e.Objective == nil || e.QuestId == "" {
+			return fmt.Errorf("objective and questId are required: %w", ErrInvalidChange)
+		}
+		m.applyObjective(i, e)
+
+	case DependencyCreated, DependencyDeleted:
+		if e.Dependency == nil {
+			return fmt.Errorf("dependency is required: %w", ErrInvalidChange)
+		}
+		m.applyDependency(i, e)
+
+	default:
+		return fmt.Errorf("unsupported type '%s': %w", e.Type, ErrInvalidChange)
+	}
+	return nil
+}
+
+func (m *merger) applyQuest(i int, e Event) {
+	change := *e.Quest
+	quest := m.findQuest(change.Id)
+
+	switch {
+	case quest == nil && e.Type == QuestCreated:
+		change.Objectives = slices.Clone(change.Objectives)
+		change.CompletedAt, change.Updated = nil, nil
+		m.merged.Quests = append(m.merged.Quests, change)
+		m.applied++
+
+	case quest == nil && e.Type == QuestDeleted:
+		// already gone
+
+	case quest == nil:
+		m.deleted(i, e, change.Id)
+
+	case e.Type == QuestCreated || e.Type == QuestUpdated:
+		if questChanged(*quest, change) && m.resolve(i, e, quest.Id, quest.Updated) {
+			quest.Title, quest.Description, quest.Position = change.Title, change.Description, change.Position
+			quest.Color, quest.Effort, quest.Due, quest.ChildQuestlineId = change.Color, change.Effort, change.Due, change.ChildQuestlineId
+		}
+
+	case e.Type == QuestCompleted || e.Type == QuestReopened:
+		completed := e.Type == QuestCompleted
+		if quest.Completed != completed && m.resolve(i, e, quest.Id, quest.Updated) {
+			quest.Completed = completed
+		}
+
+	case e.Type == QuestDeleted:
+		if m.resolve(i, e, quest.Id, quest.Updated) {
+			m.merged.Quests = slices.DeleteFunc(m.merged.Quests, func(q models.Quest) bool { return q.Id == change.Id })
+			m.merged.Dependencies = slices.DeleteFunc(m.merged.Dependencies, func(d models.Dependency) bool {
+				return d.From == change.Id || d.To == change.Id
+			})
+			m.merged.ExternalDependencies = slices.DeleteFunc(m.merged.ExternalDependencies, func(d models.ExternalDependency) bool {
+				return d.To == change.Id
+			})
+		}
+	}
+}
+
+func (m *merger) applyObjective(i int, e Event) {
+	change := *e.Objective
+	quest := m.findQuest(e.QuestId)
+	if quest == nil {
+		if e.Type != ObjectiveDeleted {
+			m.deleted(i, e, e.QuestId)
+		}
+		return
+	}
+
+	// objective IDs are unique across quests, so one on another quest is not created or changed again
+	if other, _ := m.findObjective(change.Id); other != nil && other.Id != quest.Id {
+		m.conflicts = append(m.conflicts, Conflict{
+			Change: i, Type: e.Type, EntityId: change.Id, Resolution: ResolvedServer, ServerTime: other.Updated,
+			Reason: fmt.Sprintf("belongs to quest %s on server", other.Id),
+		})
+		return
+	}
+
+	j := slices.IndexFunc(quest.Objectives, func(o models.Objective) bool { return o.Id == change.Id })
+	switch {
+	case j < 0 && e.Type == ObjectiveCreated:
+		change.NextReset, change.Streak, change.BestStreak, change.Updated = nil, 0, 0, nil
+		quest.Objectives = append(quest.Objectives, change)
+		m.applied++
+
+	case j < 0 && e.Type == ObjectiveUpdated:
+		m.deleted(i, e, change.Id)
+
+	case j < 0:
+		// already gone
+
+	case e.Type == ObjectiveDeleted:
+		if m.resolve(i, e, change.Id, quest.Objectives[j].Updated) {
+			quest.Objectives = slices.Delete(quest.Objectives, j, j+1)
+		}
+
+	default:
+		o := &quest.Objectives[j]
+		if objectiveChanged(*o, change) && m.resolve(i, e, o.Id, o.Updated) {
+			o.Text, o.Completed, o.SortIndex, o.Recurrence, o.Due = change.Text, change.Completed, change.SortIndex, change.Recurrence, change.Due
+		}
+	}
+}
+
+func (m *merger) applyDependency(i int, e Event) {
+	change := *e.Dependency
+	change.QuestlineId = ""
+	exists := slices.ContainsFunc(m.merged.Dependencies, func(d models.Dependency) bool {
+		return d.From == change.From && d.To == change.To
+	})
+
+	if e.Type == DependencyDeleted {
+		if exists {
+			m.merged.Dependencies = slices.DeleteFunc(m.merged.Dependencies, func(d models.Dependency) bool {
+				return d.From == change.From && d.To == change.To
+			})
+			m.applied++
+		}
+		return
+	}
+
+	for _, questId := range []string{change.From, change.To} {
+		if m.findQuest(questId) == nil {
+			m.deleted(i, e, questId)
+			return
+		}
+	}
+	if !exists {
+		m.merged.Dependencies = append(m.merged.Dependencies, change)
+		m.applied++
+	}
+}
+
+// renumbers objectives of a quest if merging left them with the same sort index, keeping their order
+func fixSortIndexes(quest *models.Quest) {
+	seen := make(map[int]bool, len(quest.Objectives))
+	for _, o := range quest.Objectives {
+		if seen[o.SortIndex] || o.SortIndex < 0 {
+			sort.SliceStable(quest.Objectives, func(a, b int) bool {
+				return quest.Objectives[a].SortIndex < quest.Objectives[b].SortIndex
+			})
+			for j := range quest.Objectives {
+				quest.Objectives[j].SortIndex = j
+			}
+			return
+		}
+		seen[o.SortIndex] = true
+	}
+}
@@ -0,0 +1,42 @@
+import axios from "axios";
+import type { SessionInfo, User } from "../../types";
+
+const API_BASE = '/api'
+
+const apiClient = axios.create({
+    baseURL: API_BASE,
+    headers: {
+        'Content-Type': 'application/json',
+    },
+});
+
+export class AuthService {
+
+    async getCurrentUser(): Promise<User | null> {
+        try {
+            const resp = await apiClient.get<User>('/auth/me');
+            return resp.data;
+        } catch (e) {
+            if (axios.isAxiosError(e) && e.response?.status === 401) {
+                return null; // not logged in
+            }
+            throw e;
+        }
+    }
+
+    async login(username: string, password: string): Promise<SessionInfo> {
+        const resp = await apiClient.post<SessionInfo>('/auth/login', { username, password });
+        return resp.data;
+    }
+
+    async register(username: string, password: string): Promise<SessionInfo> {
+        const resp = await apiClient.post<SessionInfo>('/auth/register', { username, password });
+        return resp.data;
+    }
+
+    async logout(): Promise<void> {
+        await apiClient.post('/auth/logout');
+    }
+};
+
+export const authApiService = new AuthService();
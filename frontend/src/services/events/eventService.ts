@@ -0,0 +1,31 @@
+import { v4 as uuidv4 } from 'uuid';
+import type { QuestlineEvent } from '../../types';
+
+const API_BASE = '/api'
+const isBrowserOnlyMode = import.meta.env.VITE_APP_MODE === 'browser_only';
+
+// identifies this tab so it can ignore events caused by its own saves
+export const CLIENT_ID_HEADER = 'X-Client-Id';
+export const clientId = uuidv4();
+
+export class EventService {
+
+    // subscribe to live changes of a questline, returns function to unsubscribe
+    subscribe(questlineId: string, onEvent: (event: QuestlineEvent) => void): () => void {
+        if (isBrowserOnlyMode || typeof EventSource === 'undefined') {
+            return () => {};
+        }
+        const source = new EventSource(`${API_BASE}/questlines/${questlineId}/events`, { withCredentials: true });
+
+        source.onmessage = (msg: MessageEvent) => {
+            try {
+                onEvent(JSON.parse(msg.data) as QuestlineEvent);
+            } catch (e) {
+                console.error('Failed to parse questline event', e);
+            }
+        };
+        return () => source.close();
+    }
+};
+
+export const eventApiService = new EventService();
@@ -1,6 +1,7 @@
 import axios from "axios";
-import type { Questline, QuestlineInfo } from "../../types"
+import type { Questline, QuestlineInfo, TrashItem } from "../../types"
 import type { IQuestlineService } from "./questlineService.types";
+import { CLIENT_ID_HEADER, clientId } from "../events/eventService";
 
 const API_BASE = '/api'
 
@@ -8,6 +9,7 @@ const apiClient = axios.create({
     baseURL: API_BASE,
     headers: {
         'Content-Type': 'application/json',
+        [CLIENT_ID_HEADER]: clientId,
     },
 });
 
@@ -33,10 +35,25 @@ export class QuestlineHttpService implements IQuestlineService {
         return resp.data;
     }
 
+    // moves questline to the trash
     async deleteQuestline(id: string): Promise<void> {
         await apiClient.delete(`/questlines/${id}`);
     }
 
+    async getTrash(): Promise<TrashItem[]> {
+        const resp = await apiClient.get<TrashItem[]>('/trash');
+        return resp.data;
+    }
+
+    async restoreFromTrash(item: TrashItem): Promise<Questline> {
+        const resp = await apiClient.post<Questline>(`/trash/${item.type}s/${item.id}/restore`);
+        return resp.data;
+    }
+
+    async purgeFromTrash(item: TrashItem): Promise<void> {
+        await apiClient.delete(`/trash/${item.type}s/${item.id}`);
+    }
+
     exportQuestline(id: string, format: string): void {
         window.location.href = `${API_BASE}/questlines/${id}/export?format=${format}`;
     }
@@ -0,0 +1,21 @@
+import axios from "axios";
+import type { Questline } from "../../types";
+
+const API_BASE = '/api'
+
+const apiClient = axios.create({
+    baseURL: API_BASE,
+    headers: {
+        'Content-Type': 'application/json',
+    },
+});
+
+export class ShareService {
+
+    async getSharedQuestline(token: string): Promise<Questline> {
+        const resp = await apiClient.get<Questline>(`/public/${encodeURIComponent(token)}`);
+        return resp.data;
+    }
+};
+
+export const shareApiService = new ShareService();
@@ -0,0 +1,81 @@
+import { ref } from 'vue';
+import { defineStore } from 'pinia';
+import axios from 'axios';
+
+import { authApiService } from '../services/auth/authService';
+import type { User } from '../types';
+
+export const useAuthStore = defineStore('auth', () => {
+
+  // browser-only mode has no server, so no accounts
+  const isAuthEnabled = import.meta.env.VITE_APP_MODE !== 'browser_only';
+
+  // state
+  const currentUser = ref<User | null>(null);
+  const showLoginModal = ref(false);
+  const authError = ref<string | null>(null);
+
+  function errorMessageOf(e: unknown): string {
+    if (axios.isAxiosError(e) && e.response?.data?.detail) {
+      return e.response.data.detail;
+    }
+    return e instanceof Error ? e.message : String(e);
+  }
+
+  async function fetchCurrentUser(): Promise<boolean> {
+    try {
+      currentUser.value = await authApiService.getCurrentUser();
+    } catch (e) {
+      console.error('Failed to fetch current user', e);
+      currentUser.value = null;
+    }
+    return currentUser.value !== null;
+  }
+
+  async function login(username: string, password: string): Promise<boolean> {
+    authError.value = null;
+    try {
+      const session = await authApiService.login(username, password);
+      currentUser.value = session.user;
+      showLoginModal.value = false;
+      return true;
+    } catch (e) {
+      authError.value = errorMessageOf(e);
+      return false;
+    }
+  }
+
+  async function register(username: string, password: string): Promise<boolean> {
+    authError.value = null;
+    try {
+      const session = await authApiService.register(username, password);
+      currentUser.value = session.user;
+      showLoginModal.value = false;
+      return true;
+    } catch (e) {
+      authError.value = errorMessageOf(e);
+      return false;
+    }
+  }
+
+  async function logout() {
+    try {
+      await authApiService.logout();
+    } finally {
+      currentUser.value = null;
+      window.location.reload(); // drop any loaded questline
+    }
+  }
+
+  function openLoginModal() {
+    authError.value = null;
+    showLoginModal.value = true;
+  }
+
+  return {
+    // properties
+    isAuthEnabled, currentUser, showLoginModal, authError,
+    // functions
+    fetchCurrentUser, login, register, logout, openLoginModal,
+  };
+});
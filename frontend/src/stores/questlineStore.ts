@@ -2,14 +2,18 @@ import { ref, computed, nextTick, watch } from 'vue';
 import { defineStore } from 'pinia';
 import { type Connection, type Node, type Edge, MarkerType } from '@vue-flow/core';
 import { v4 as uuidv4 } from 'uuid';
+import axios from 'axios';
 
 import { questlineApiService } from '../services/questline';
-import type { Questline, Quest, Dependency, QuestlineInfo, Position as QuestPosition } from '../types';
+import { shareApiService } from '../services/share/shareService';
+import { clientId, eventApiService } from '../services/events/eventService';
+import type { Questline, Quest, Dependency, QuestlineInfo, QuestlineEvent, Problem, Position as QuestPosition } from '../types';
 
 export const useQuestlineStore = defineStore('questline', () => {
 
   // constants
   const ERROR_MSG_WAIT_MS = 3000;
+  const REMOTE_CHANGE_DEBOUNCE_MS = 250;
   const SUCCESS_MSG_WAIT_MS = 5000;
   const IS_DARK_MODE_KEY = "isDarkMode";
   const LAST_ACTIVE_QUESTLINE_ID_KEY = "lastActiveQuestlineId";
@@ -18,6 +22,11 @@ export const useQuestlineStore = defineStore('questline', () => {
   const allQuestlineInfos = ref<QuestlineInfo[]>([]);
   const selectedQuestForEdit = ref<Quest | null>(null);
   const hasUnsavedChanges = ref(false);
+  const isReadOnly = ref(false); // viewing a public share link
+
+  let unsubscribeEvents: (() => void) | null = null;
+  let subscribedId: string | null = null;
+  let remoteChangeTimer: ReturnType<typeof setTimeout> | null = null;
 
   const hoveredNodeId = ref<string | null>(null);
   const hoveredEdgeId = ref<string | null>(null);
@@ -50,6 +59,12 @@ export const useQuestlineStore = defineStore('questline', () => {
   };
 
   const areAllPrerequisitesCompleted = (quest: Quest): boolean => {
+    // prerequisites in other questlines are read-only references
+    const externalDeps = (currQuestline.value.externalDependencies || []).filter(d => d.to === quest.id);
+    if (!externalDeps.every(d => d.from.completed)) {
+      return false;
+    }
+
     const prereqIds = getPrerequisiteQuestIds(quest);
     if (prereqIds.length === 0) {
       return true; // no prerequisites
@@ -146,9 +161,20 @@ export const useQuestlineStore = defineStore('questline', () => {
     });
   });
 
+  function errorMessageOf(e: unknown): string {
+    const problem = axios.isAxiosError(e) ? (e.response?.data as Problem | undefined) : undefined;
+    if (problem?.errors?.length) {
+      return problem.errors.map((fe) => `${fe.field} ${fe.message}`).join(', ');
+    }
+    if (problem?.detail) {
+      return problem.detail;
+    }
+    return e instanceof Error ? e.message : String(e);
+  }
+
   function handleError(e: unknown, msg: string, duration: number = SUCCESS_MSG_WAIT_MS) {
     console.error(msg, e);
-    const errMsg = e instanceof Error ? e.message : String(e);
+    const errMsg = errorMessageOf(e);
     errorMsg.value = `${msg}: ${errMsg}`;
     successMsg.value = null;
     setTimeout(() => (errorMsg.value = null), duration);
@@ -196,12 +222,14 @@ export const useQuestlineStore = defineStore('questline', () => {
       if (!id) {
         currQuestline.value = blankQuestline;
         localStorage.removeItem(LAST_ACTIVE_QUESTLINE_ID_KEY);
+        subscribeToChanges(null);
         markDirty();
       } else {
         const data = await questlineApiService.getQuestline(id);
         currQuestline.value = data;
         localStorage.setItem(LAST_ACTIVE_QUESTLINE_ID_KEY, id);
         markClean();
+        subscribeToChanges(id);
       }
     } catch (e) {
       handleError(e, `Failed to load questline ${id}`);
@@ -210,6 +238,7 @@ export const useQuestlineStore = defineStore('questline', () => {
       // fallback to empty questline
       if (currQuestline.value.id === id || id !== null) {
         currQuestline.value = blankQuestline;
+        subscribeToChanges(null);
         markDirty();
       }
     } finally {
@@ -217,6 +246,71 @@ export const useQuestlineStore = defineStore('questline', () => {
     }
   }
 
+  // follow changes other people save to the questline
+  function subscribeToChanges(id: string | null) {
+    if (id === subscribedId) {
+      return;
+    }
+    unsubscribeEvents?.();
+    unsubscribeEvents = id ? eventApiService.subscribe(id, handleRemoteChange) : null;
+    subscribedId = id;
+  }
+
+  function handleRemoteChange(event: QuestlineEvent) {
+    if (event.origin === clientId || event.questlineId !== currQuestline.value.id) {
+      return;
+    }
+    if (event.type === 'questline.deleted') {
+      subscribeToChanges(null);
+      errorMsg.value = `Questline ${event.name} was deleted by someone else`;
+      setTimeout(() => errorMsg.value = null, ERROR_MSG_WAIT_MS);
+      return;
+    }
+    // a single save sends several events, only refresh once
+    if (remoteChangeTimer) {
+      clearTimeout(remoteChangeTimer);
+    }
+    remoteChangeTimer = setTimeout(refreshFromRemote, REMOTE_CHANGE_DEBOUNCE_MS);
+  }
+
+  async function refreshFromRemote() {
+    remoteChangeTimer = null;
+    const id = currQuestline.value.id;
+
+    // don't throw away local edits, saving will overwrite remote changes instead
+    if (!id || hasUnsavedChanges.value) {
+      errorMsg.value = 'Questline was changed by someone else';
+      setTimeout(() => errorMsg.value = null, ERROR_MSG_WAIT_MS);
+      return;
+    }
+    try {
+      const data = await questlineApiService.getQuestline(id);
+      if (currQuestline.value.id !== id || hasUnsavedChanges.value) {
+        return;
+      }
+      currQuestline.value = data;
+      await nextTick();
+      markClean();
+    } catch (e) {
+      handleError(e, `Failed to refresh questline ${id}`);
+    }
+  }
+
+  async function loadSharedQuestline(token: string) {
+    isLoading.value = true;
+    errorMsg.value = null;
+    isReadOnly.value = true;
+
+    try {
+      currQuestline.value = await shareApiService.getSharedQuestline(token);
+      markClean();
+    } catch (e) {
+      handleError(e, 'Failed to load shared questline');
+    } finally {
+      isLoading.value = false;
+    }
+  }
+
   function setQuestlineFromLoadedData(loaded: Questline): boolean {
     currQuestline.value = {
       ...loaded,
@@ -225,12 +319,16 @@ export const useQuestlineStore = defineStore('questline', () => {
       dependencies: loaded.dependencies || [],
     };
     localStorage.removeItem(LAST_ACTIVE_QUESTLINE_ID_KEY);
+    subscribeToChanges(null);
     markDirty();
     handleSuccess(`Questline loaded from file`);
     return true;
   }
 
   async function saveCurrentQuestline() {
+    if (isReadOnly.value) {
+      return;
+    }
     if (!currQuestline.value.name.trim()) {
       errorMsg.value = 'Questline name cannot be empty';
       setTimeout(() => errorMsg.value = null, ERROR_MSG_WAIT_MS);
@@ -257,6 +355,7 @@ export const useQuestlineStore = defineStore('questline', () => {
 
       if (saved.id) {
         localStorage.setItem(LAST_ACTIVE_QUESTLINE_ID_KEY, saved.id);
+        subscribeToChanges(saved.id);
       }
       await fetchAllQuestlineInfos();
       markClean();
@@ -601,10 +700,10 @@ export const useQuestlineStore = defineStore('questline', () => {
     nodes, edges, selectedQuestForEdit,
     showQuestEditor, showLoadModal, showHelpModal, isDarkMode, 
     hoveredNodeId, hoveredEdgeId,
-    hasUnsavedChanges,
+    hasUnsavedChanges, isReadOnly,
     // functions
     handleSuccess, handleError,
-    fetchAllQuestlineInfos, loadQuestline, saveCurrentQuestline, deleteCurrentQuestline,
+    fetchAllQuestlineInfos, loadQuestline, loadSharedQuestline, saveCurrentQuestline, deleteCurrentQuestline,
     addQuestNode, updateQuestPosition, addQuestDependency, updateQuestlineName,
     removeQuestNodes, removeQuestDependencies,
     addObjective, removeObjective,
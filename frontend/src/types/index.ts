@@ -8,6 +8,13 @@ export interface Objective {
   text: string | null;
   completed: boolean;
   sortIndex: number;
+  due?: string;
+  recurrence?: string; // rule like FREQ=WEEKLY, empty for one-shot objectives
+  periodStart?: string;
+  nextReset?: string;
+  streak?: number;
+  bestStreak?: number;
+  updated?: string; // set by server
 }
 
 export interface Quest {
@@ -18,6 +25,11 @@ export interface Quest {
   color?: string;
   objectives?: Objective[];
   completed: boolean;
+  effort?: number;
+  due?: string;
+  completedAt?: string; // set by server
+  updated?: string; // set by server
+  childQuestlineId?: string; // completed is derived from this questline
 }
 
 export interface Dependency {
@@ -25,11 +37,36 @@ export interface Dependency {
   to: string;
 }
 
+export interface ExternalQuestRef {
+  questlineId: string;
+  questlineName: string;
+  questId: string;
+  title: string;
+  completed: boolean;
+}
+
+export interface ExternalDependency {
+  from: ExternalQuestRef;
+  to: string;
+}
+
+// summary of a questline a quest is broken down into
+export interface ChildQuestline {
+  questId: string;
+  questlineId: string;
+  name: string;
+  totalQuests: number;
+  completedQuests: number;
+}
+
 export interface Questline {
   id: string | null;
+  ownerId?: string;
   name: string;
   quests: Quest[];
   dependencies: Dependency[];
+  externalDependencies?: ExternalDependency[];
+  childQuestlines?: ChildQuestline[]; // read-only
   created?: string;
   updated?: string;
 }
@@ -40,8 +77,61 @@ export interface QuestlineInfo {
   updated: string;
   totalQuests: number;
   completedQuests: number;
+  role?: 'viewer' | 'editor' | 'owner';
+  shared?: boolean;
+}
+
+export interface TrashItem {
+  type: 'questline' | 'quest';
+  id: string;
+  name: string; // questline name or quest title
+  questlineId: string;
+  questlineName: string;
+  deletedAt: string;
+  purgeAt?: string; // kept until purged if not set
+}
+
+export interface User {
+  id: string;
+  username: string;
+  created: string;
+}
+
+export interface SessionInfo {
+  user: User;
+  token: string;
+  expires: string;
 }
 
 export interface ExposedQuestBoard {
   addNewQuestAtViewportCenter: () => void;
 }
+
+export interface QuestlineEvent {
+  id: string;
+  type: string;
+  questlineId: string;
+  name?: string;
+  questId?: string;
+  quest?: Quest;
+  objective?: Objective;
+  dependency?: Dependency;
+  userId?: string;
+  origin?: string;
+  time: string;
+}
+
+export interface FieldError {
+  field: string; // path like quests[0].title
+  message: string;
+}
+
+// RFC 7807 problem details sent by the API for errors
+export interface Problem {
+  type: string;
+  title: string;
+  status: number;
+  detail?: string;
+  requestId?: string;
+  errors?: FieldError[];
+}
@@ -0,0 +1,165 @@
+package graph
+
+import (
+	"barrettotte/questlines/models"
+	"errors"
+)
+
+var ErrCycle = errors.New("questline dependencies contain a cycle")
+
+// weight of a quest on the critical path, unestimated quests count as one unit of effort
+func questWeight(q models.Quest, weighted bool) float64 {
+	if weighted && q.Effort > 0 {
+		return q.Effort
+	}
+	return 1
+}
+
+// TopologicalOrder orders quest IDs so every quest comes after its prerequisites.
+// Ties are broken by the order quests appear in the questline.
+func TopologicalOrder(ql *models.Questline) ([]string, error) {
+	known := make(map[string]bool, len(ql.Quests))
+	for _, q := range ql.Quests {
+		known[q.Id] = true
+	}
+
+	inDegree := make(map[string]int, len(ql.Quests))
+	downstream := make(map[string][]string)
+	for _, d := range ql.Dependencies {
+		if !known[d.From] || !known[d.To] {
+			continue // ignore dangling dependencies
+		}
+		inDegree[d.To]++
+		downstream[d.From] = append(downstream[d.From], d.To)
+	}
+
+	queue := make([]string, 0, len(ql.Quests))
+	for _, q := range ql.Quests {
+		if inDegree[q.Id] == 0 {
+			queue = append(queue, q.Id)
+		}
+	}
+
+	order := make([]string, 0, len(ql.Quests))
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		order = append(order, curr)
+
+		for _, next := range downstream[curr] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if len(order) != len(ql.Quests) {
+		return nil, ErrCycle
+	}
+	return order, nil
+}
+
+// Levels groups quest IDs by depth, where a quest's depth is one more than its deepest prerequisite
+func Levels(ql *models.Questline) ([][]string, error) {
+	order, err := TopologicalOrder(ql)
+	if err != nil {
+		return nil, err
+	}
+	depths := depthsOf(ql, order)
+
+	levels := make([][]string, 0)
+	for _, id := range order {
+		depth := depths[id]
+		for len(levels) <= depth {
+			levels = append(levels, make([]string, 0))
+		}
+		levels[depth] = append(levels[depth], id)
+	}
+	return levels, nil
+}
+
+// computes depth of each quest from a topological order
+func depthsOf(ql *models.Questline, order []string) map[string]int {
+	upstream := upstreamOf(ql)
+	depths := make(map[string]int, len(order))
+
+	for _, id := range order {
+		depth := 0
+		for _, prereqId := range upstream[id] {
+			if prereqDepth, ok := depths[prereqId]; ok && prereqDepth+1 > depth {
+				depth = prereqDepth + 1
+			}
+		}
+		depths[id] = depth
+	}
+	return depths
+}
+
+// CriticalPath finds the longest chain of dependent quests and its total weight
+func CriticalPath(ql *models.Questline, weighted bool) ([]string, float64, error) {
+	order, err := TopologicalOrder(ql)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	quests := make(map[string]models.Quest, len(ql.Quests))
+	for _, q := range ql.Quests {
+		quests[q.Id] = q
+	}
+	upstream := upstreamOf(ql)
+
+	// longest weighted path ending at each quest
+	lengths := make(map[string]float64, len(order))
+	prev := make(map[string]string, len(order))
+
+	endId := ""
+	for _, id := range order {
+		best := 0.0
+		for _, prereqId := range upstream[id] {
+			if l, ok := lengths[prereqId]; ok && l > best {
+				best = l
+				prev[id] = prereqId
+			}
+		}
+		lengths[id] = best + questWeight(quests[id], weighted)
+
+		if endId == "" || lengths[id] > lengths[endId] {
+			endId = id
+		}
+	}
+
+	path := make([]string, 0)
+	if endId == "" {
+		return path, 0, nil
+	}
+	for id := endId; id != ""; id = prev[id] {
+		path = append([]string{id}, path...)
+	}
+	return path, lengths[endId], nil
+}
+
+// Analyze computes topological order, depth levels, and critical path of a questline
+func Analyze(ql *models.Questline, weighted bool) (*models.QuestlineAnalysis, error) {
+	order, err := TopologicalOrder(ql)
+	if err != nil {
+		return nil, err
+	}
+	levels, err := Levels(ql)
+	if err != nil {
+		return nil, err
+	}
+	path, length, err := CriticalPath(ql, weighted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.QuestlineAnalysis{
+		QuestlineId:        ql.Id,
+		Weighted:           weighted,
+		Order:              order,
+		Levels:             levels,
+		CriticalPath:       path,
+		CriticalPathLength: length,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package graph
+
+import (
+	"barrettotte/questlines/models"
+	"sort"
+)
+
+// maps each quest to the quests that directly require it
+func downstreamOf(ql *models.Questline) map[string][]string {
+	downstream := make(map[string][]string)
+	for _, d := range ql.Dependencies {
+		downstream[d.From] = append(downstream[d.From], d.To)
+	}
+	return downstream
+}
+
+// maps each quest to the quests it directly requires
+func upstreamOf(ql *models.Questline) map[string][]string {
+	upstream := make(map[string][]string)
+	for _, d := range ql.Dependencies {
+		upstream[d.To] = append(upstream[d.To], d.From)
+	}
+	return upstream
+}
+
+// counts incomplete quests reachable downstream of a quest
+func countUnblocks(questId string, downstream map[string][]string, completed map[string]bool) int {
+	seen := map[string]bool{questId: true}
+	stack := []string{questId}
+	count := 0
+
+	for len(stack) > 0 {
+		curr := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, next := range downstream[curr] {
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			stack = append(stack, next)
+
+			if !completed[next] {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Available finds incomplete quests whose prerequisites, including those in other questlines,
+// are all completed, ranked by how many incomplete downstream quests they unblock
+func Available(ql *models.Questline) []models.AvailableQuest {
+	completed := make(map[string]bool, len(ql.Quests))
+	for _, q := range ql.Quests {
+		completed[q.Id] = q.Completed
+	}
+
+	available := availableIn(ql, downstreamOf(ql), completed)
+	SortAvailable(available)
+	return available
+}
+
+// AvailableAcross finds available quests of several questlines, ranked by how many incomplete downstream quests
+// they unblock in any of them, counting quests in other questlines that depend on them
+func AvailableAcross(qls []*models.Questline) []models.AvailableQuest {
+	completed := make(map[string]bool)
+	downstream := make(map[string][]string)
+	for _, ql := range qls {
+		for _, q := range ql.Quests {
+			completed[q.Id] = q.Completed
+		}
+		for _, d := range ql.Dependencies {
+			downstream[d.From] = append(downstream[d.From], d.To)
+		}
+		for _, d := range ql.ExternalDependencies {
+			downstream[d.From.QuestId] = append(downstream[d.From.QuestId], d.To)
+		}
+	}
+
+	available := make([]models.AvailableQuest, 0)
+	for _, ql := range qls {
+		available = append(available, availableIn(ql, downstream, completed)...)
+	}
+	SortAvailable(available)
+	return available
+}
+
+// finds available quests of a questline, counting what they unblock with the given downstream quests
+func availableIn(ql *models.Questline, downstream map[string][]string, completed map[string]bool) []models.AvailableQuest {
+	known := make(map[string]bool, len(ql.Quests))
+	for _, q := range ql.Quests {
+		known[q.Id] = true
+	}
+
+	upstream := upstreamOf(ql)
+
+	// prerequisites in other questlines
+	externalBlocked := make(map[string]bool)
+	for _, d := range ql.ExternalDependencies {
+		if !d.From.Completed {
+			externalBlocked[d.To] = true
+		}
+	}
+
+	available := make([]models.AvailableQuest, 0)
+	for _, q := range ql.Quests {
+		if q.Completed || externalBlocked[q.Id] {
+			continue
+		}
+
+		unlocked := true
+		for _, prereqId := range upstream[q.Id] {
+			// dangling dependencies do not block anything
+			if known[prereqId] && !completed[prereqId] {
+				unlocked = false
+				break
+			}
+		}
+		if !unlocked {
+			continue
+		}
+
+		available = append(available, models.AvailableQuest{
+			QuestlineId:   ql.Id,
+			QuestlineName: ql.Name,
+			Quest:         q,
+			Unblocks:      countUnblocks(q.Id, downstream, completed),
+		})
+	}
+	return available
+}
+
+// SortAvailable orders available quests by most unblocked first
+func SortAvailable(available []models.AvailableQuest) {
+	sort.SliceStable(available, func(i, j int) bool {
+		if available[i].Unblocks != available[j].Unblocks {
+			return available[i].Unblocks > available[j].Unblocks
+		}
+		return available[i].Quest.Title < available[j].Quest.Title
+	})
+}
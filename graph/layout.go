@@ -0,0 +1,159 @@
+package graph
+
+import (
+	"barrettotte/questlines/models"
+	"errors"
+	"math"
+	"sort"
+)
+
+const (
+	LayoutLayered = "layered"
+	LayoutGrid    = "grid"
+
+	DirectionLeftRight = "LR"
+	DirectionTopBottom = "TB"
+)
+
+var ErrUnknownLayout = errors.New("unknown layout algorithm")
+var ErrUnknownDirection = errors.New("unknown layout direction")
+
+// spacing between nodes, sized around the quest node in the frontend
+const (
+	layerSpacingLR = 350.0
+	nodeSpacingLR  = 150.0
+	layerSpacingTB = 200.0
+	nodeSpacingTB  = 325.0
+
+	// barycenter sweeps for reducing edge crossings
+	orderingSweeps = 4
+)
+
+// Layout computes positions of all quests in a questline in place
+func Layout(ql *models.Questline, algo string, direction string) error {
+	if direction != DirectionLeftRight && direction != DirectionTopBottom {
+		return ErrUnknownDirection
+	}
+
+	switch algo {
+	case LayoutLayered:
+		return layoutLayered(ql, direction)
+	case LayoutGrid:
+		return layoutGrid(ql, direction)
+	default:
+		return ErrUnknownLayout
+	}
+}
+
+// converts a layer and index within it to a position
+func positionOf(layer int, index int, layerSize int, direction string) models.Position {
+	offset := float64(index) - float64(layerSize-1)/2
+
+	if direction == DirectionTopBottom {
+		return models.Position{X: offset * nodeSpacingTB, Y: float64(layer) * layerSpacingTB}
+	}
+	return models.Position{X: float64(layer) * layerSpacingLR, Y: offset * nodeSpacingLR}
+}
+
+// applies positions by quest ID
+func applyPositions(ql *models.Questline, positions map[string]models.Position) {
+	for i := range ql.Quests {
+		if pos, ok := positions[ql.Quests[i].Id]; ok {
+			ql.Quests[i].Position = pos
+		}
+	}
+}
+
+// Sugiyama-style layout: longest path layering, then barycenter ordering within layers
+func layoutLayered(ql *models.Questline, direction string) error {
+	levels, err := Levels(ql)
+	if err != nil {
+		return err
+	}
+
+	upstream := upstreamOf(ql)
+	downstream := downstreamOf(ql)
+
+	// index of each quest within its layer
+	indexes := make(map[string]int)
+	for _, level := range levels {
+		for i, id := range level {
+			indexes[id] = i
+		}
+	}
+
+	for sweep := 0; sweep < orderingSweeps; sweep++ {
+		if sweep%2 == 0 {
+			for i := 1; i < len(levels); i++ {
+				orderByBarycenter(levels[i], upstream, indexes)
+			}
+		} else {
+			for i := len(levels) - 2; i >= 0; i-- {
+				orderByBarycenter(levels[i], downstream, indexes)
+			}
+		}
+	}
+
+	positions := make(map[string]models.Position)
+	for layer, level := range levels {
+		for i, id := range level {
+			positions[id] = positionOf(layer, i, len(level), direction)
+		}
+	}
+	applyPositions(ql, positions)
+	return nil
+}
+
+// sorts a layer by the average index of each quest's neighbors
+func orderByBarycenter(level []string, neighbors map[string][]string, indexes map[string]int) {
+	barycenters := make(map[string]float64, len(level))
+	for _, id := range level {
+		sum := 0.0
+		count := 0
+		for _, neighborId := range neighbors[id] {
+			if idx, ok := indexes[neighborId]; ok {
+				sum += float64(idx)
+				count++
+			}
+		}
+
+		if count == 0 {
+			barycenters[id] = float64(indexes[id]) // keep current spot
+		} else {
+			barycenters[id] = sum / float64(count)
+		}
+	}
+
+	sort.SliceStable(level, func(i, j int) bool {
+		return barycenters[level[i]] < barycenters[level[j]]
+	})
+	for i, id := range level {
+		indexes[id] = i
+	}
+}
+
+// arranges quests in a square-ish grid, in topological order when possible
+func layoutGrid(ql *models.Questline, direction string) error {
+	order, err := TopologicalOrder(ql)
+	if err != nil {
+		if !errors.Is(err, ErrCycle) {
+			return err
+		}
+		// fall back to questline order
+		order = make([]string, 0, len(ql.Quests))
+		for _, q := range ql.Quests {
+			order = append(order, q.Id)
+		}
+	}
+
+	columns := max(int(math.Ceil(math.Sqrt(float64(len(order))))), 1)
+	rows := (len(order) + columns - 1) / columns
+	positions := make(map[string]models.Position, len(order))
+
+	// quests run along the layout direction, wrapping into a new row every few columns
+	for i, id := range order {
+		positions[id] = positionOf(i%columns, i/columns, rows, direction)
+	}
+	applyPositions(ql, positions)
+	return nil
+}
@@ -0,0 +1,187 @@
+package ical
+
+import (
+	"barrettotte/questlines/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ProdId = "-//barrettotte//questlines//EN"
+
+	// RFC 5545 lines longer than this are folded
+	maxLineLength = 75
+
+	dateTimeFormat = "20060102T150405Z"
+	dateFormat     = "20060102"
+)
+
+// Options controls how quests and objectives are emitted
+type Options struct {
+	Events bool // emit all-day VEVENTs on due dates instead of VTODOs
+}
+
+// writes content lines with escaping and folding
+type writer struct {
+	sb strings.Builder
+}
+
+func (w *writer) line(name string, value string) {
+	line := name + ":" + value
+
+	// fold without splitting UTF-8 characters
+	for len(line) > maxLineLength {
+		cut := maxLineLength
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+		w.sb.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	w.sb.WriteString(line + "\r\n")
+}
+
+func (w *writer) text(name string, value string) {
+	w.line(name, escape(value))
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func formatDateTime(t time.Time) string {
+	return t.UTC().Format(dateTimeFormat)
+}
+
+// item with a due date that becomes a calendar component
+type item struct {
+	uid         string
+	summary     string
+	description string
+	due         time.Time
+	start       *time.Time
+	completed   bool
+	completedAt *time.Time
+	rrule       string
+}
+
+// items collects quests and objectives with due dates, recurring objectives are due at their next reset
+func items(ql *models.Questline) []item {
+	result := make([]item, 0)
+
+	for _, q := range ql.Quests {
+		if q.Due != nil {
+			result = append(result, item{
+				uid:         fmt.Sprintf("quest-%s@questlines", q.Id),
+				summary:     q.Title,
+				description: strings.TrimSpace(fmt.Sprintf("%s\n\n%s", ql.Name, q.Description)),
+				due:         *q.Due,
+				completed:   q.Completed,
+				completedAt: q.CompletedAt,
+			})
+		}
+
+		for _, o := range q.Objectives {
+			it := item{
+				uid:         fmt.Sprintf("objective-%s@questlines", o.Id),
+				summary:     o.Text,
+				description: fmt.Sprintf("%s - %s", ql.Name, q.Title),
+				completed:   o.Completed,
+			}
+			switch {
+			case o.Due != nil:
+				it.due = *o.Due
+			case o.Recurrence != "" && o.NextReset != nil:
+				it.start = o.PeriodStart
+				it.due = *o.NextReset
+				it.rrule = o.Recurrence
+			default:
+				continue
+			}
+			result = append(result, it)
+		}
+	}
+	return result
+}
+
+// Feed renders questlines as an iCalendar feed
+func Feed(name string, questlines []*models.Questline, opts Options, now time.Time) string {
+	w := &writer{}
+	w.line("BEGIN", "VCALENDAR")
+	w.line("VERSION", "2.0")
+	w.line("PRODID", ProdId)
+	w.line("CALSCALE", "GREGORIAN")
+	w.line("METHOD", "PUBLISH")
+	w.text("X-WR-CALNAME", name)
+
+	for _, ql := range questlines {
+		for _, it := range items(ql) {
+			if opts.Events {
+				writeEvent(w, it, now)
+			} else {
+				writeTodo(w, it, now)
+			}
+		}
+	}
+
+	w.line("END", "VCALENDAR")
+	return w.sb.String()
+}
+
+func writeTodo(w *writer, it item, now time.Time) {
+	w.line("BEGIN", "VTODO")
+	w.line("UID", it.uid)
+	w.line("DTSTAMP", formatDateTime(now))
+	w.text("SUMMARY", it.summary)
+	w.text("DESCRIPTION", it.description)
+	if it.start != nil {
+		w.line("DTSTART", formatDateTime(*it.start))
+	}
+	w.line("DUE", formatDateTime(it.due))
+	if it.rrule != "" {
+		w.line("RRULE", it.rrule)
+	}
+
+	if it.completed {
+		w.line("STATUS", "COMPLETED")
+		w.line("PERCENT-COMPLETE", "100")
+		if it.completedAt != nil {
+			w.line("COMPLETED", formatDateTime(*it.completedAt))
+		}
+	} else {
+		w.line("STATUS", "NEEDS-ACTION")
+	}
+	w.line("END", "VTODO")
+}
+
+// VEVENT has no completed status, so completed items are marked in the summary and shown as free time
+func writeEvent(w *writer, it item, now time.Time) {
+	day := it.due.In(time.Local)
+
+	w.line("BEGIN", "VEVENT")
+	w.line("UID", it.uid)
+	w.line("DTSTAMP", formatDateTime(now))
+	w.line("DTSTART;VALUE=DATE", day.Format(dateFormat))
+	w.line("DTEND;VALUE=DATE", day.AddDate(0, 0, 1).Format(dateFormat))
+	if it.rrule != "" {
+		w.line("RRULE", it.rrule)
+	}
+	w.text("DESCRIPTION", it.description)
+
+	if it.completed {
+		w.text("SUMMARY", "✓ "+it.summary)
+		w.line("STATUS", "CONFIRMED")
+		w.line("X-QUESTLINES-STATUS", "COMPLETED")
+		w.line("TRANSP", "TRANSPARENT")
+	} else {
+		w.text("SUMMARY", it.summary)
+		w.line("STATUS", "CONFIRMED")
+		w.line("TRANSP", "OPAQUE")
+	}
+	w.line("END", "VEVENT")
+}
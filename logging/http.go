@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/google/uuid"
+)
+
+const RequestIdHeader = "X-Request-Id"
+
+// request IDs from clients or proxies are kept if they are reasonable
+var validRequestId = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// response writer remembering the error a request failed with
+type responseWriter struct {
+	middleware.WrapResponseWriter
+	err string
+}
+
+// keep streaming responses working
+func (w *responseWriter) Flush() {
+	if f, ok := w.WrapResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// SetError records the error a request failed with, so it is logged with the request
+func SetError(w http.ResponseWriter, msg string) {
+	for {
+		switch rw := w.(type) {
+		case *responseWriter:
+			rw.err = msg
+			return
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			// not a request going through the middleware
+			slog.Error("Request failed", "error", msg)
+			return
+		}
+	}
+}
+
+// Middleware assigns each request an ID and logs it once handled
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIdHeader)
+		if !validRequestId.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(RequestIdHeader, id)
+
+		ctx := WithRequestId(r.Context(), id)
+		lw := &responseWriter{WrapResponseWriter: middleware.NewWrapResponseWriter(w, r.ProtoMajor)}
+
+		next.ServeHTTP(lw, r.WithContext(ctx))
+
+		status := lw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", lw.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			attrs = append(attrs, slog.String("route", rctx.RoutePattern()))
+		}
+
+		level := slog.LevelInfo
+		if lw.err != "" {
+			attrs = append(attrs, slog.String("error", lw.err))
+			if status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			} else {
+				level = slog.LevelWarn
+			}
+		}
+		slog.LogAttrs(ctx, level, "Handled request", attrs...)
+	})
+}
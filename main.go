@@ -3,13 +3,20 @@ package main
 import (
 	"barrettotte/questlines/api"
 	"barrettotte/questlines/db"
+	"barrettotte/questlines/digest"
+	"barrettotte/questlines/logging"
+	"barrettotte/questlines/metrics"
+	"barrettotte/questlines/scheduler"
+	"barrettotte/questlines/version"
+	"barrettotte/questlines/webhooks"
 	"embed"
 	"flag"
 	"io/fs"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
@@ -24,8 +31,29 @@ var embeddedMigrations embed.FS
 
 func main() {
 	dbPath := flag.String("db", "questlines.db", "Path to SQLite database file")
+	allowSignup := flag.Bool("signup", true, "Allow new users to register after the first user")
+	resetInterval := flag.Duration("reset-interval", time.Minute, "How often recurring objectives are checked for a new period")
+	digestHour := flag.Int("digest-hour", 8, "Hour of the day digest emails are sent after")
+	trashDays := flag.Int("trash-days", 30, "Days deleted questlines and quests stay in the trash before they are purged, zero keeps them")
+	enableMetrics := flag.Bool("metrics", true, "Serve Prometheus metrics at /metrics")
+	logLevel := flag.String("log-level", "info", "Minimum level of logs: debug, info, warn or error")
+	logFormat := flag.String("log-format", logging.FormatJSON, "Format of logs: json or text")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false, "Allow webhooks to loopback, private and link-local addresses")
+	logPayloads := flag.Bool("log-payloads", false, "Log request payloads at debug level, may include private data")
 	flag.Parse()
 
+	level, err := logging.ParseLevel(*logLevel)
+	if err != nil {
+		logging.Fatal("Failed to configure logging", "error", err)
+	}
+	if err := logging.Setup(os.Stderr, level, *logFormat); err != nil {
+		logging.Fatal("Failed to configure logging", "error", err)
+	}
+	logging.LogPayloads = *logPayloads
+
+	build := version.Get()
+	slog.Info("Starting questlines", "version", build.Version, "commit", build.Commit, "buildTime", build.BuildTime)
+
 	port := "8080"
 	migrationsDir := "db/migrations"
 	frontendDir := "frontend/dist"
@@ -33,14 +61,37 @@ func main() {
 
 	// init db
 	if err := db.InitDB(*dbPath, migrationsDir, embeddedMigrations); err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		logging.Fatal("Failed to initialize database", "error", err)
 	}
 	defer db.DB.Close()
 
+	webhooks.AllowPrivateTargets = *webhookAllowPrivate
+	webhooks.Start()
+	scheduler.Every("reset recurring objectives", *resetInterval, scheduler.ResetRecurringObjectives)
+	if *trashDays > 0 {
+		scheduler.Every("purge trash", time.Hour, scheduler.PurgeTrash(*trashDays))
+	}
+	api.TrashDays = *trashDays
+
+	// digests are only sent when an SMTP server is configured
+	digestConfig, err := digest.ConfigFromEnv()
+	if err != nil {
+		logging.Fatal("Failed to read SMTP config", "error", err)
+	}
+	if digestConfig.Enabled() {
+		scheduler.Every("send digests", 15*time.Minute, scheduler.SendDigests(digestConfig, *digestHour))
+	} else {
+		slog.Info("SMTP_HOST not set, digest emails are disabled")
+	}
+	api.DigestConfig = digestConfig
+
 	// setup middleware
 	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+	r.Use(logging.Middleware)
 	r.Use(middleware.Recoverer)
+	if *enableMetrics {
+		r.Use(metrics.Middleware)
+	}
 
 	allowedOrigins := []string{"http://localhost:" + port}
 
@@ -53,30 +104,104 @@ func main() {
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", api.ClientIdHeader, logging.RequestIdHeader},
+		ExposedHeaders:   []string{"Link", logging.RequestIdHeader},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
+	api.AllowSignup = *allowSignup
+
+	// metrics are outside the API prefix, where Prometheus expects them
+	if *enableMetrics {
+		api.RegisterMetrics()
+		r.Get("/metrics", metrics.Handler().ServeHTTP)
+	}
+
 	// setup API routes
 	r.Route(baseApiPrefix, func(r chi.Router) {
-		// questlines
-		r.Post("/questlines", api.CreateQuestlineHandler)
-		r.Get("/questlines", api.GetQuestlinesHandler)
-		r.Get("/questlines/{id}", api.GetQuestlineHandler)
-		r.Put("/questlines/{id}", api.UpdateQuestlineHandler)
-		r.Delete("/questlines/{id}", api.DeleteQuestlineHandler)
-		r.Get("/questlines/{id}/export", api.ExportQuestlineHandler)
+		r.NotFound(api.NotFoundHandler)
+		r.MethodNotAllowed(api.MethodNotAllowedHandler)
+
+		// auth
+		r.Post("/auth/register", api.RegisterHandler)
+		r.Post("/auth/login", api.LoginHandler)
+		// public
+		r.Get("/public/{token}", api.GetPublicQuestlineHandler)
 		// misc
 		r.Get("/up", api.UpHandler)
+		r.Get("/health/live", api.LivenessHandler)
+		r.Get("/health/ready", api.ReadinessHandler)
+		r.Get("/openapi.json", api.OpenApiHandler(r, baseApiPrefix))
+
+		r.Group(func(r chi.Router) {
+			r.Use(api.Authenticate)
+			r.Post("/auth/logout", api.LogoutHandler)
+			r.Get("/auth/me", api.CurrentUserHandler)
+			// questlines
+			r.Post("/questlines", api.CreateQuestlineHandler)
+			r.Get("/questlines", api.GetQuestlinesHandler)
+			r.Get("/questlines/{id}", api.GetQuestlineHandler)
+			r.Put("/questlines/{id}", api.UpdateQuestlineHandler)
+			r.Patch("/questlines/{id}", api.PatchQuestlineHandler)
+			r.Delete("/questlines/{id}", api.DeleteQuestlineHandler)
+			r.Get("/questlines/{id}/export", api.ExportQuestlineHandler)
+			r.Get("/questlines/{id}/events", api.QuestlineEventsHandler)
+			r.Get("/questlines/{id}/calendar.ics", api.QuestlineCalendarHandler)
+			r.Get("/questlines/{id}/available", api.GetAvailableQuestsHandler)
+			r.Get("/questlines/{id}/analysis", api.GetQuestlineAnalysisHandler)
+			r.Get("/questlines/{id}/objectives/{objectiveId}/history", api.GetObjectiveHistoryHandler)
+			r.Post("/questlines/{id}/layout", api.LayoutQuestlineHandler)
+			r.Post("/questlines/{id}/clone", api.CloneQuestlineHandler)
+			r.Post("/questlines/{id}/sync", api.SyncQuestlineHandler)
+			r.Post("/questlines/{id}/template", api.CreateTemplateFromQuestlineHandler)
+			r.Get("/questlines/{id}/permissions", api.GetQuestlinePermissionsHandler)
+			r.Put("/questlines/{id}/permissions", api.ShareQuestlineHandler)
+			r.Delete("/questlines/{id}/permissions/{userId}", api.UnshareQuestlineHandler)
+			r.Post("/questlines/{id}/share", api.CreateShareLinkHandler)
+			r.Get("/questlines/{id}/shares", api.GetShareLinksHandler)
+			r.Delete("/questlines/{id}/shares/{shareId}", api.DeleteShareLinkHandler)
+			r.Get("/next", api.GetNextQuestsHandler)
+			r.Post("/batch", api.BatchHandler)
+			r.Get("/calendar.ics", api.CalendarHandler)
+			// trash
+			r.Get("/trash", api.GetTrashHandler)
+			r.Post("/trash/questlines/{id}/restore", api.RestoreQuestlineHandler)
+			r.Delete("/trash/questlines/{id}", api.PurgeQuestlineHandler)
+			r.Post("/trash/quests/{id}/restore", api.RestoreQuestHandler)
+			r.Delete("/trash/quests/{id}", api.PurgeQuestHandler)
+			// templates
+			r.Get("/templates", api.GetTemplatesHandler)
+			r.Post("/templates", api.CreateTemplateHandler)
+			r.Get("/templates/{id}", api.GetTemplateHandler)
+			r.Delete("/templates/{id}", api.DeleteTemplateHandler)
+			r.Post("/templates/{id}/instantiate", api.InstantiateTemplateHandler)
+			// api tokens
+			r.With(api.RequireSession).Get("/tokens", api.GetApiTokensHandler)
+			r.With(api.RequireSession).Post("/tokens", api.CreateApiTokenHandler)
+			r.With(api.RequireSession).Delete("/tokens/{id}", api.DeleteApiTokenHandler)
+			// digests
+			r.Get("/digest", api.GetDigestHandler)
+			r.Put("/digest", api.SetDigestHandler)
+			r.Post("/digest/confirm", api.ConfirmDigestHandler)
+			r.Delete("/digest", api.DeleteDigestHandler)
+			r.Get("/digest/preview", api.PreviewDigestHandler)
+			r.Post("/digest/send", api.SendDigestHandler)
+			// webhooks
+			r.Get("/webhooks", api.GetWebhooksHandler)
+			r.Post("/webhooks", api.CreateWebhookHandler)
+			r.Get("/webhooks/{id}", api.GetWebhookHandler)
+			r.Delete("/webhooks/{id}", api.DeleteWebhookHandler)
+			r.Get("/webhooks/{id}/deliveries", api.GetWebhookDeliveriesHandler)
+			r.Post("/webhooks/{id}/test", api.TestWebhookHandler)
+		})
 	})
 
 	// get frontend assets
 	distFS, err := fs.Sub(embeddedFrontend, frontendDir)
 	if err != nil {
-		log.Fatalf("Failed to get embedded subdirectory: %v", err)
+		logging.Fatal("Failed to get embedded subdirectory", "error", err)
 	}
 
 	// file server for serving frontend
@@ -87,7 +212,7 @@ func main() {
 
 		// handle API requests
 		if strings.HasPrefix(r.URL.Path, baseApiPrefix) {
-			http.NotFound(w, r)
+			api.NotFoundHandler(w, r)
 			return
 		}
 
@@ -98,7 +223,7 @@ func main() {
 		if os.IsNotExist(err) || fsPath == "" {
 			indexHTML, err := embeddedFrontend.ReadFile(frontendDir + "/index.html")
 			if err != nil {
-				log.Printf("ERROR: Could not read embedded index.html: %v", err)
+				slog.ErrorContext(r.Context(), "Could not read embedded index.html", "error", err)
 				http.Error(w, "index.html not found", http.StatusInternalServerError)
 				return
 			}
@@ -109,7 +234,7 @@ func main() {
 
 		// misc error
 		if err != nil {
-			log.Printf("ERROR: Could not open static file %s: %v", fsPath, err)
+			slog.ErrorContext(r.Context(), "Could not open static file", "path", fsPath, "error", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -118,8 +243,8 @@ func main() {
 		fsHandler.ServeHTTP(w, r)
 	})
 
-	log.Printf("Listening on port %s...", port)
+	slog.Info("Listening", "port", port)
 	if err := http.ListenAndServe(":"+port, r); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		logging.Fatal("Server failed to start", "error", err)
 	}
 }
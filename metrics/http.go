@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.With(Registry).NewCounterVec(prometheus.CounterOpts{
+		Name: "questlines_http_requests_total", Help: "Number of HTTP requests handled.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name: "questlines_http_request_duration_seconds", Help: "Latency of HTTP requests.", Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	dbDuration = promauto.With(Registry).NewHistogramVec(prometheus.HistogramOpts{
+		Name: "questlines_db_query_duration_seconds", Help: "Latency of database operations.", Buckets: QueryBuckets,
+	}, []string{"query"})
+)
+
+// Middleware records count and latency of requests by their route pattern, so IDs don't create new series
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequests.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveQuery records how long a database operation took since start, meant to be deferred
+func ObserveQuery(query string, start time.Time) {
+	dbDuration.WithLabelValues(query).Observe(time.Since(start).Seconds())
+}
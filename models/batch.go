@@ -0,0 +1,114 @@
+package models
+
+import "fmt"
+
+const (
+	BatchCompleteQuest = "completeQuest"
+	BatchAddObjective  = "addObjective"
+	BatchMoveQuest     = "moveQuest"
+	BatchAddDependency = "addDependency"
+	BatchDeleteQuest   = "deleteQuest"
+
+	MaxBatchOperations = 1000
+)
+
+// BatchOperation is a single change of a batch, fields used depend on op
+type BatchOperation struct {
+	Op          string     `json:"op"`
+	QuestlineId string     `json:"questlineId"`
+	QuestId     string     `json:"questId,omitempty"`   // all but addDependency
+	Completed   *bool      `json:"completed,omitempty"` // completeQuest, true if omitted
+	Objective   *Objective `json:"objective,omitempty"` // addObjective, appended to the quest
+	Position    *Position  `json:"position,omitempty"`  // moveQuest
+	From        string     `json:"from,omitempty"`      // addDependency, prerequisite quest
+	To          string     `json:"to,omitempty"`        // addDependency
+}
+
+func (o BatchOperation) String() string {
+	return fmt.Sprintf("BatchOperation{Op: '%v', QuestlineId: '%v', QuestId: '%v', From: '%v', To: '%v'}",
+		o.Op, o.QuestlineId, o.QuestId, o.From, o.To,
+	)
+}
+
+type BatchRequest struct {
+	Operations []BatchOperation `json:"operations"`
+}
+
+func (b BatchRequest) String() string {
+	return fmt.Sprintf("BatchRequest{Operations: %v}", b.Operations)
+}
+
+// BatchResult is the outcome of a batch operation, with IDs of anything it created
+type BatchResult struct {
+	Index       int    `json:"index"`
+	Op          string `json:"op"`
+	QuestlineId string `json:"questlineId"`
+	QuestId     string `json:"questId,omitempty"`
+	ObjectiveId string `json:"objectiveId,omitempty"`
+}
+
+func (r BatchResult) String() string {
+	return fmt.Sprintf("BatchResult{Index: %d, Op: '%v', QuestlineId: '%v', QuestId: '%v', ObjectiveId: '%v'}",
+		r.Index, r.Op, r.QuestlineId, r.QuestId, r.ObjectiveId,
+	)
+}
+
+type BatchResponse struct {
+	Results    []BatchResult `json:"results"`
+	Questlines []Questline   `json:"questlines"` // changed questlines after the batch
+}
+
+func (b BatchResponse) String() string {
+	return fmt.Sprintf("BatchResponse{Results: %v, Questlines: %d}", b.Results, len(b.Questlines))
+}
+
+// Validate checks operations have the fields their op needs, questlines are validated when the batch is applied
+func (b *BatchRequest) Validate() []FieldError {
+	v := &validator{}
+
+	if len(b.Operations) == 0 {
+		v.add("operations", "is required")
+	} else if len(b.Operations) > MaxBatchOperations {
+		v.add("operations", "must have at most %d operations", MaxBatchOperations)
+	}
+
+	for i, op := range b.Operations {
+		field := fmt.Sprintf("operations[%d]", i)
+		if op.QuestlineId == "" {
+			v.add(field+".questlineId", "is required")
+		}
+
+		switch op.Op {
+		case BatchCompleteQuest, BatchDeleteQuest:
+			if op.QuestId == "" {
+				v.add(field+".questId", "is required")
+			}
+		case BatchAddObjective:
+			if op.QuestId == "" {
+				v.add(field+".questId", "is required")
+			}
+			if op.Objective == nil {
+				v.add(field+".objective", "is required")
+			}
+		case BatchMoveQuest:
+			if op.QuestId == "" {
+				v.add(field+".questId", "is required")
+			}
+			if op.Position == nil {
+				v.add(field+".position", "is required")
+			}
+		case BatchAddDependency:
+			if op.From == "" {
+				v.add(field+".from", "is required")
+			}
+			if op.To == "" {
+				v.add(field+".to", "is required")
+			}
+		default:
+			v.add(field+".op", "must be one of %s, %s, %s, %s or %s",
+				BatchCompleteQuest, BatchAddObjective, BatchMoveQuest, BatchAddDependency, BatchDeleteQuest,
+			)
+		}
+	}
+	return v.errors
+}
@@ -2,9 +2,39 @@ package models
 
 import (
 	"fmt"
+	"slices"
 	"time"
 )
 
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+const (
+	TrashQuestline = "questline"
+	TrashQuest     = "quest"
+)
+
+var roleRanks = map[string]int{RoleViewer: 1, RoleEditor: 2, RoleOwner: 3}
+
+// IsValidRole checks if role is a known questline role
+func IsValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// RoleAtLeast checks if role grants at least the access of the required role
+func RoleAtLeast(role string, required string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[required]
+}
+
 type Position struct {
 	X float64 `json:"x"`
 	Y float64 `json:"y"`
@@ -15,17 +45,24 @@ func (p Position) String() string {
 }
 
 type Objective struct {
-	Id        string `json:"id"`
-	QuestId   string `json:"-"` // internal
-	Text      string `json:"text"`
-	Completed bool   `json:"completed"`
-	SortIndex int    `json:"sortIndex"`
+	Id          string     `json:"id"`
+	QuestId     string     `json:"-"` // internal
+	Text        string     `json:"text"`
+	Completed   bool       `json:"completed"`
+	SortIndex   int        `json:"sortIndex"`
+	Due         *time.Time `json:"due,omitempty"`
+	Recurrence  string     `json:"recurrence,omitempty"`  // rule like FREQ=WEEKLY, empty for one-shot objectives
+	PeriodStart *time.Time `json:"periodStart,omitempty"` // start of current period of recurring objective
+	NextReset   *time.Time `json:"nextReset,omitempty"`   // derived
+	Streak      int        `json:"streak,omitempty"`      // derived
+	BestStreak  int        `json:"bestStreak,omitempty"`  // derived
+	Updated     *time.Time `json:"updated,omitempty"`     // set by server
 }
 
 func (o Objective) String() string {
 	return fmt.Sprintf(
-		"Objective{Id: '%v', QuestId: '%v', Text: %v, Completed: %v, SortIndex: %d}",
-		o.Id, o.QuestId, o.Text, o.Completed, o.SortIndex,
+		"Objective{Id: '%v', QuestId: '%v', Text: %v, Completed: %v, SortIndex: %d, Recurrence: '%v', Streak: %d}",
+		o.Id, o.QuestId, o.Text, o.Completed, o.SortIndex, o.Recurrence, o.Streak,
 	)
 }
 
@@ -38,12 +75,19 @@ type Quest struct {
 	Color       string      `json:"color,omitempty"`
 	Objectives  []Objective `json:"objectives,omitempty"`
 	Completed   bool        `json:"completed"`
+	Effort      float64     `json:"effort,omitempty"`
+	Due         *time.Time  `json:"due,omitempty"`
+	CompletedAt *time.Time  `json:"completedAt,omitempty"` // set by server
+	Updated     *time.Time  `json:"updated,omitempty"`     // set by server
+
+	// questline the quest is broken down into, completed is then derived from its progress
+	ChildQuestlineId string `json:"childQuestlineId,omitempty"`
 }
 
 func (q Quest) String() string {
 	return fmt.Sprintf(
-		"Quest{Id: %q, QuestlineId: '%v', Title: '%v', Description: '%v', Position: %v, Color: '%v', Objectives: %v, Completed: %v}",
-		q.Id, q.QuestlineId, q.Title, q.Description, q.Position, q.Color, q.Objectives, q.Completed,
+		"Quest{Id: %q, QuestlineId: '%v', Title: '%v', Description: '%v', Position: %v, Color: '%v', Objectives: %v, Completed: %v, Effort: %f, Due: %v, ChildQuestlineId: '%v'}",
+		q.Id, q.QuestlineId, q.Title, q.Description, q.Position, q.Color, q.Objectives, q.Completed, q.Effort, q.Due, q.ChildQuestlineId,
 	)
 }
 
@@ -57,32 +101,320 @@ func (d Dependency) String() string {
 	return fmt.Sprintf("Dependency{QuestlineId: '%v', From: '%v', To: '%v'}", d.QuestlineId, d.From, d.To)
 }
 
+// reference to a quest in another questline
+type ExternalQuestRef struct {
+	QuestlineId   string     `json:"questlineId"`
+	QuestlineName string     `json:"questlineName"`
+	QuestId       string     `json:"questId"`
+	Title         string     `json:"title"`
+	Completed     bool       `json:"completed"`
+	CompletedAt   *time.Time `json:"completedAt,omitempty"`
+}
+
+func (r ExternalQuestRef) String() string {
+	return fmt.Sprintf("ExternalQuestRef{QuestlineId: '%v', QuestlineName: '%v', QuestId: '%v', Title: '%v', Completed: %v}",
+		r.QuestlineId, r.QuestlineName, r.QuestId, r.Title, r.Completed,
+	)
+}
+
+// summary of a questline a quest is broken down into
+type ChildQuestline struct {
+	QuestId         string `json:"questId"`
+	QuestlineId     string `json:"questlineId"`
+	Name            string `json:"name"`
+	TotalQuests     int    `json:"totalQuests"`
+	CompletedQuests int    `json:"completedQuests"`
+}
+
+func (c ChildQuestline) String() string {
+	return fmt.Sprintf("ChildQuestline{QuestId: '%v', QuestlineId: '%v', Name: '%v', TotalQuests: %d, CompletedQuests: %d}",
+		c.QuestId, c.QuestlineId, c.Name, c.TotalQuests, c.CompletedQuests,
+	)
+}
+
+// dependency on a quest in another questline
+type ExternalDependency struct {
+	From ExternalQuestRef `json:"from"`
+	To   string           `json:"to"`
+}
+
+func (d ExternalDependency) String() string {
+	return fmt.Sprintf("ExternalDependency{From: %v, To: '%v'}", d.From, d.To)
+}
+
 type Questline struct {
-	Id           string       `json:"id"`
-	Name         string       `json:"name"`
-	Quests       []Quest      `json:"quests"`
-	Dependencies []Dependency `json:"dependencies"`
-	Created      time.Time    `json:"created"`
-	Updated      time.Time    `json:"updated"`
+	Id                   string               `json:"id"`
+	OwnerId              string               `json:"ownerId"`
+	Name                 string               `json:"name"`
+	Quests               []Quest              `json:"quests"`
+	Dependencies         []Dependency         `json:"dependencies"`
+	ExternalDependencies []ExternalDependency `json:"externalDependencies"`
+	ChildQuestlines      []ChildQuestline     `json:"childQuestlines,omitempty"` // read-only
+	Created              time.Time            `json:"created"`
+	Updated              time.Time            `json:"updated"`
 }
 
 func (ql Questline) String() string {
 	return fmt.Sprintf(
-		"Questline{Id: '%v', Name: '%v', Quests: %v, Dependencies: %v, Created: %v, Updated: %v}",
-		ql.Id, ql.Name, ql.Quests, ql.Dependencies, ql.Created.Format(time.RFC3339), ql.Updated.Format(time.RFC3339),
+		"Questline{Id: '%v', OwnerId: '%v', Name: '%v', Quests: %v, Dependencies: %v, ExternalDependencies: %v, ChildQuestlines: %v, Created: %v, Updated: %v}",
+		ql.Id, ql.OwnerId, ql.Name, ql.Quests, ql.Dependencies, ql.ExternalDependencies, ql.ChildQuestlines,
+		ql.Created.Format(time.RFC3339), ql.Updated.Format(time.RFC3339),
 	)
 }
 
+// Clone deep copies a questline so the copy can be changed without changing the original,
+// times are shared since they are never changed in place
+func (ql *Questline) Clone() *Questline {
+	dst := *ql
+	dst.Quests = make([]Quest, len(ql.Quests))
+	for i, q := range ql.Quests {
+		q.Objectives = slices.Clone(q.Objectives)
+		dst.Quests[i] = q
+	}
+	dst.Dependencies = slices.Clone(ql.Dependencies)
+	dst.ExternalDependencies = slices.Clone(ql.ExternalDependencies)
+	dst.ChildQuestlines = slices.Clone(ql.ChildQuestlines)
+	return &dst
+}
+
 type QuestlineInfo struct {
 	Id              string    `json:"id"`
 	Name            string    `json:"name"`
 	Updated         time.Time `json:"updated"`
 	TotalQuests     int       `json:"totalQuests"`
 	CompletedQuests int       `json:"completedQuests"`
+	Role            string    `json:"role"`
+	Shared          bool      `json:"shared"` // shared by another user
 }
 
 func (q QuestlineInfo) String() string {
-	return fmt.Sprintf("QuestlineInfo{Id: '%v', Name: '%v', Updated: %v, TotalQuests: %d, CompletedQuests: %d}",
-		q.Id, q.Name, q.Updated.Format(time.RFC3339), q.TotalQuests, q.CompletedQuests,
+	return fmt.Sprintf("QuestlineInfo{Id: '%v', Name: '%v', Updated: %v, TotalQuests: %d, CompletedQuests: %d, Role: '%v', Shared: %v}",
+		q.Id, q.Name, q.Updated.Format(time.RFC3339), q.TotalQuests, q.CompletedQuests, q.Role, q.Shared,
+	)
+}
+
+type TrashItem struct {
+	Type          string     `json:"type"` // questline or quest
+	Id            string     `json:"id"`
+	Name          string     `json:"name"` // questline name or quest title
+	QuestlineId   string     `json:"questlineId"`
+	QuestlineName string     `json:"questlineName"`
+	DeletedAt     time.Time  `json:"deletedAt"`
+	PurgeAt       *time.Time `json:"purgeAt,omitempty"` // kept until purged if nil
+}
+
+func (t TrashItem) String() string {
+	return fmt.Sprintf("TrashItem{Type: '%v', Id: '%v', Name: '%v', QuestlineId: '%v', DeletedAt: %v}",
+		t.Type, t.Id, t.Name, t.QuestlineId, t.DeletedAt.Format(time.RFC3339),
+	)
+}
+
+type AvailableQuest struct {
+	QuestlineId   string `json:"questlineId"`
+	QuestlineName string `json:"questlineName"`
+	Quest         Quest  `json:"quest"`
+	Unblocks      int    `json:"unblocks"`
+}
+
+func (a AvailableQuest) String() string {
+	return fmt.Sprintf("AvailableQuest{QuestlineId: '%v', QuestlineName: '%v', Quest: %v, Unblocks: %d}",
+		a.QuestlineId, a.QuestlineName, a.Quest, a.Unblocks,
+	)
+}
+
+type QuestlineAnalysis struct {
+	QuestlineId        string     `json:"questlineId"`
+	Weighted           bool       `json:"weighted"`
+	Order              []string   `json:"order"`
+	Levels             [][]string `json:"levels"`
+	CriticalPath       []string   `json:"criticalPath"`
+	CriticalPathLength float64    `json:"criticalPathLength"`
+}
+
+func (a QuestlineAnalysis) String() string {
+	return fmt.Sprintf(
+		"QuestlineAnalysis{QuestlineId: '%v', Weighted: %v, Order: %v, Levels: %v, CriticalPath: %v, CriticalPathLength: %f}",
+		a.QuestlineId, a.Weighted, a.Order, a.Levels, a.CriticalPath, a.CriticalPathLength,
+	)
+}
+
+type Template struct {
+	Id          string    `json:"id"`
+	OwnerId     string    `json:"ownerId"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Questline   Questline `json:"questline"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+}
+
+func (t Template) String() string {
+	return fmt.Sprintf(
+		"Template{Id: '%v', OwnerId: '%v', Name: '%v', Description: '%v', Questline: %v, Created: %v, Updated: %v}",
+		t.Id, t.OwnerId, t.Name, t.Description, t.Questline, t.Created.Format(time.RFC3339), t.Updated.Format(time.RFC3339),
+	)
+}
+
+type TemplateInfo struct {
+	Id          string    `json:"id"`
+	OwnerId     string    `json:"ownerId"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	TotalQuests int       `json:"totalQuests"`
+	Updated     time.Time `json:"updated"`
+}
+
+func (t TemplateInfo) String() string {
+	return fmt.Sprintf("TemplateInfo{Id: '%v', OwnerId: '%v', Name: '%v', Description: '%v', TotalQuests: %d, Updated: %v}",
+		t.Id, t.OwnerId, t.Name, t.Description, t.TotalQuests, t.Updated.Format(time.RFC3339),
+	)
+}
+
+type User struct {
+	Id           string    `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"-"` // internal
+	Created      time.Time `json:"created"`
+}
+
+func (u User) String() string {
+	return fmt.Sprintf("User{Id: '%v', Username: '%v', Created: %v}", u.Id, u.Username, u.Created.Format(time.RFC3339))
+}
+
+type Permission struct {
+	QuestlineId string    `json:"-"` // internal
+	UserId      string    `json:"userId"`
+	Username    string    `json:"username"`
+	Role        string    `json:"role"`
+	Creator     bool      `json:"creator"` // creator's ownership cannot be revoked
+	Created     time.Time `json:"created"`
+}
+
+func (p Permission) String() string {
+	return fmt.Sprintf("Permission{QuestlineId: '%v', UserId: '%v', Username: '%v', Role: '%v', Creator: %v, Created: %v}",
+		p.QuestlineId, p.UserId, p.Username, p.Role, p.Creator, p.Created.Format(time.RFC3339),
+	)
+}
+
+type ApiToken struct {
+	Id       string     `json:"id"`
+	UserId   string     `json:"-"` // internal
+	Name     string     `json:"name"`
+	Scope    string     `json:"scope"`
+	Token    string     `json:"token,omitempty"` // only returned once when created
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastUsed,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+func (t ApiToken) String() string {
+	return fmt.Sprintf("ApiToken{Id: '%v', UserId: '%v', Name: '%v', Scope: '%v', Created: %v, LastUsed: %v, Expires: %v}",
+		t.Id, t.UserId, t.Name, t.Scope, t.Created.Format(time.RFC3339), t.LastUsed, t.Expires,
+	)
+}
+
+type ShareLink struct {
+	Id                 string     `json:"id"`
+	QuestlineId        string     `json:"questlineId"`
+	Token              string     `json:"token,omitempty"` // only returned once when created
+	Url                string     `json:"url,omitempty"`   // only returned once when created
+	RedactDescriptions bool       `json:"redactDescriptions"`
+	Created            time.Time  `json:"created"`
+	Expires            *time.Time `json:"expires,omitempty"`
+}
+
+func (s ShareLink) String() string {
+	return fmt.Sprintf("ShareLink{Id: '%v', QuestlineId: '%v', RedactDescriptions: %v, Created: %v, Expires: %v}",
+		s.Id, s.QuestlineId, s.RedactDescriptions, s.Created.Format(time.RFC3339), s.Expires,
+	)
+}
+
+type Webhook struct {
+	Id          string    `json:"id"`
+	UserId      string    `json:"-"`                     // internal
+	QuestlineId string    `json:"questlineId,omitempty"` // empty for every questline the user can access
+	Url         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"` // only returned once when created
+	Events      []string  `json:"events"`
+	Created     time.Time `json:"created"`
+}
+
+func (h Webhook) String() string {
+	return fmt.Sprintf("Webhook{Id: '%v', UserId: '%v', QuestlineId: '%v', Url: '%v', Events: %v, Created: %v}",
+		h.Id, h.UserId, h.QuestlineId, h.Url, h.Events, h.Created.Format(time.RFC3339),
+	)
+}
+
+type WebhookDelivery struct {
+	Id         string    `json:"id"`
+	WebhookId  string    `json:"webhookId"`
+	EventId    string    `json:"eventId"`
+	EventType  string    `json:"eventType"`
+	Attempt    int       `json:"attempt"`
+	Payload    string    `json:"payload"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int64     `json:"durationMs"`
+	Created    time.Time `json:"created"`
+}
+
+func (d WebhookDelivery) String() string {
+	return fmt.Sprintf(
+		"WebhookDelivery{Id: '%v', WebhookId: '%v', EventId: '%v', EventType: '%v', Attempt: %d, StatusCode: %d, Success: %v, Created: %v}",
+		d.Id, d.WebhookId, d.EventId, d.EventType, d.Attempt, d.StatusCode, d.Success, d.Created.Format(time.RFC3339),
+	)
+}
+
+// event waiting to be delivered to a webhook
+type QueuedWebhookDelivery struct {
+	Id          string    `json:"id"`
+	Webhook     Webhook   `json:"webhook"`
+	EventId     string    `json:"eventId"`
+	EventType   string    `json:"eventType"`
+	Payload     string    `json:"payload"`
+	Attempts    int       `json:"attempts"` // attempts made so far
+	NextAttempt time.Time `json:"nextAttempt"`
+	Created     time.Time `json:"created"`
+}
+
+func (d QueuedWebhookDelivery) String() string {
+	return fmt.Sprintf("QueuedWebhookDelivery{Id: '%v', WebhookId: '%v', EventId: '%v', EventType: '%v', Attempts: %d, NextAttempt: %v}",
+		d.Id, d.Webhook.Id, d.EventId, d.EventType, d.Attempts, d.NextAttempt.Format(time.RFC3339),
+	)
+}
+
+// finished period of a recurring objective
+type ObjectiveCompletion struct {
+	Id          string    `json:"id"`
+	ObjectiveId string    `json:"objectiveId"`
+	PeriodStart time.Time `json:"periodStart"`
+	Completed   bool      `json:"completed"`
+	Created     time.Time `json:"created"`
+}
+
+func (c ObjectiveCompletion) String() string {
+	return fmt.Sprintf("ObjectiveCompletion{Id: '%v', ObjectiveId: '%v', PeriodStart: %v, Completed: %v}",
+		c.Id, c.ObjectiveId, c.PeriodStart.Format(time.RFC3339), c.Completed,
+	)
+}
+
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+type DigestSubscription struct {
+	UserId    string     `json:"-"` // internal
+	Email     string     `json:"email"`
+	Frequency string     `json:"frequency"`
+	Confirmed bool       `json:"confirmed"` // digests are only sent to confirmed addresses
+	LastSent  *time.Time `json:"lastSent,omitempty"`
+	Created   time.Time  `json:"created"`
+}
+
+func (d DigestSubscription) String() string {
+	return fmt.Sprintf("DigestSubscription{UserId: '%v', Email: '%v', Frequency: '%v', Confirmed: %v, LastSent: %v}",
+		d.UserId, d.Email, d.Frequency, d.Confirmed, d.LastSent,
 	)
 }
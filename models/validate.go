@@ -0,0 +1,168 @@
+package models
+
+import (
+	"barrettotte/questlines/recurrence"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	MaxNameLength        = 200
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 10000
+	MaxObjectiveLength   = 1000
+	MaxQuests            = 1000
+	MaxObjectives        = 200
+	MaxCoordinate        = 1_000_000
+)
+
+// colors are hex like #rgb, #rrggbb or #rrggbbaa
+var colorPattern = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})$`)
+
+// FieldError describes an invalid field, using a path like quests[0].title
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) String() string {
+	return fmt.Sprintf("FieldError{Field: '%v', Message: '%v'}", e.Field, e.Message)
+}
+
+// collects field errors while validating
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field string, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) length(field string, value string, min int, max int) {
+	n := utf8.RuneCountInString(strings.TrimSpace(value))
+	if n < min {
+		v.add(field, "is required")
+	} else if utf8.RuneCountInString(value) > max {
+		v.add(field, "must be at most %d characters", max)
+	}
+}
+
+func (v *validator) coordinate(field string, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) || math.Abs(value) > MaxCoordinate {
+		v.add(field, "must be between %d and %d", -MaxCoordinate, MaxCoordinate)
+	}
+}
+
+// Validate checks a questline before saving, returning an error for each invalid field
+func (ql *Questline) Validate() []FieldError {
+	v := &validator{}
+	v.length("name", ql.Name, 1, MaxNameLength)
+
+	if len(ql.Quests) > MaxQuests {
+		v.add("quests", "must have at most %d quests", MaxQuests)
+	}
+
+	questIds := make(map[string]bool, len(ql.Quests))
+	objectiveIds := make(map[string]bool)
+
+	for i, q := range ql.Quests {
+		path := fmt.Sprintf("quests[%d]", i)
+
+		if q.Id == "" {
+			v.add(path+".id", "is required")
+		} else if questIds[q.Id] {
+			v.add(path+".id", "duplicates quest %s", q.Id)
+		}
+		questIds[q.Id] = true
+
+		v.length(path+".title", q.Title, 1, MaxTitleLength)
+		v.length(path+".description", q.Description, 0, MaxDescriptionLength)
+		v.coordinate(path+".position.x", q.Position.X)
+		v.coordinate(path+".position.y", q.Position.Y)
+
+		if q.Color != "" && !colorPattern.MatchString(q.Color) {
+			v.add(path+".color", "must be a hex color like #1a2b3c")
+		}
+		if q.ChildQuestlineId != "" && q.ChildQuestlineId == ql.Id {
+			v.add(path+".childQuestlineId", "cannot be the questline of the quest")
+		}
+		if q.Effort < 0 || math.IsNaN(q.Effort) || math.IsInf(q.Effort, 0) {
+			v.add(path+".effort", "must not be negative")
+		}
+		if len(q.Objectives) > MaxObjectives {
+			v.add(path+".objectives", "must have at most %d objectives", MaxObjectives)
+		}
+
+		sortIndexes := make(map[int]bool, len(q.Objectives))
+		for j, o := range q.Objectives {
+			objPath := fmt.Sprintf("%s.objectives[%d]", path, j)
+
+			if o.Id == "" {
+				v.add(objPath+".id", "is required")
+			} else if objectiveIds[o.Id] {
+				v.add(objPath+".id", "duplicates objective %s", o.Id)
+			}
+			objectiveIds[o.Id] = true
+
+			v.length(objPath+".text", o.Text, 0, MaxObjectiveLength)
+
+			if o.SortIndex < 0 {
+				v.add(objPath+".sortIndex", "must not be negative")
+			} else if sortIndexes[o.SortIndex] {
+				v.add(objPath+".sortIndex", "duplicates sort index %d", o.SortIndex)
+			}
+			sortIndexes[o.SortIndex] = true
+
+			if o.Recurrence != "" {
+				if _, err := recurrence.Parse(o.Recurrence); err != nil {
+					v.add(objPath+".recurrence", "%v", err)
+				}
+			}
+		}
+	}
+
+	deps := make(map[Dependency]bool, len(ql.Dependencies))
+	for i, d := range ql.Dependencies {
+		path := fmt.Sprintf("dependencies[%d]", i)
+
+		if !questIds[d.From] {
+			v.add(path+".from", "references unknown quest %s", d.From)
+		}
+		if !questIds[d.To] {
+			v.add(path+".to", "references unknown quest %s", d.To)
+		}
+		if d.From == d.To {
+			v.add(path, "quest cannot depend on itself")
+		} else if deps[d] {
+			v.add(path, "duplicates dependency from %s to %s", d.From, d.To)
+		}
+		deps[d] = true
+	}
+
+	for i, d := range ql.ExternalDependencies {
+		path := fmt.Sprintf("externalDependencies[%d]", i)
+
+		if d.From.QuestId == "" {
+			v.add(path+".from.questId", "is required")
+		}
+		if !questIds[d.To] {
+			v.add(path+".to", "references unknown quest %s", d.To)
+		}
+	}
+	return v.errors
+}
+
+// Validate checks a template before saving, its questline is checked like any questline
+func (t *Template) Validate() []FieldError {
+	v := &validator{}
+	v.length("name", t.Name, 1, MaxNameLength)
+	v.length("description", t.Description, 0, MaxDescriptionLength)
+
+	for _, e := range t.Questline.Validate() {
+		v.add("questline."+e.Field, "%s", e.Message)
+	}
+	return v.errors
+}
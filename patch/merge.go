@@ -0,0 +1,39 @@
+package patch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Merge applies a JSON Merge Patch (RFC 7396) to a JSON document.
+// Members set to null are removed, objects are merged and everything else, including arrays, is replaced
+func Merge(doc []byte, mergePatch []byte) ([]byte, error) {
+	var target, p any
+	if err := json.Unmarshal(doc, &target); err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+	if err := json.Unmarshal(mergePatch, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse merge patch: %w", ErrInvalidPatch)
+	}
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target any, p any) any {
+	members, ok := p.(map[string]any)
+	if !ok {
+		return p
+	}
+
+	merged, ok := target.(map[string]any)
+	if !ok {
+		merged = make(map[string]any, len(members))
+	}
+	for k, v := range members {
+		if v == nil {
+			delete(merged, k)
+		} else {
+			merged[k] = merge(merged[k], v)
+		}
+	}
+	return merged
+}
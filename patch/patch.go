@@ -0,0 +1,302 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	JsonPatchContentType  = "application/json-patch+json"
+	MergePatchContentType = "application/merge-patch+json"
+)
+
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+	OpMove    = "move"
+	OpCopy    = "copy"
+	OpTest    = "test"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrTestFailed   = errors.New("patch test failed")
+)
+
+// Operation is a single JSON Patch (RFC 6902) operation
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`  // move and copy only
+	Value json.RawMessage `json:"value,omitempty"` // add, replace and test only
+}
+
+func (o Operation) String() string {
+	return fmt.Sprintf("Operation{Op: '%v', Path: '%v', From: '%v', Value: %s}", o.Op, o.Path, o.From, o.Value)
+}
+
+// Apply applies JSON Patch operations to a JSON document in order, failing if any operation fails
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	var node any
+	if err := json.Unmarshal(doc, &node); err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+
+	for i, op := range ops {
+		var err error
+		if node, err = applyOperation(node, op); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(node)
+}
+
+// helper for applying a single operation, returning the new root
+func applyOperation(root any, op Operation) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case OpAdd, OpReplace, OpTest:
+		if op.Value == nil {
+			return nil, fmt.Errorf("value is required: %w", ErrInvalidPatch)
+		}
+		var value any
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value: %w", ErrInvalidPatch)
+		}
+
+		switch op.Op {
+		case OpAdd:
+			return add(root, path, value)
+		case OpReplace:
+			if root, _, err = remove(root, path); err != nil {
+				return nil, err
+			}
+			return add(root, path, value)
+		default:
+			current, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, ErrTestFailed
+			}
+			return root, nil
+		}
+
+	case OpRemove:
+		root, _, err = remove(root, path)
+		return root, err
+
+	case OpMove, OpCopy:
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		var value any
+		if op.Op == OpMove {
+			if isPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("cannot move %s into its own child: %w", op.From, ErrInvalidPatch)
+			}
+			if root, value, err = remove(root, from); err != nil {
+				return nil, err
+			}
+		} else {
+			if value, err = get(root, from); err != nil {
+				return nil, err
+			}
+			value = deepCopy(value)
+		}
+		return add(root, path, value)
+
+	default:
+		return nil, fmt.Errorf("unknown op '%s': %w", op.Op, ErrInvalidPatch)
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) like /quests/0/title into unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path '%s' must start with '/': %w", pointer, ErrInvalidPatch)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// helper for checking if a path starts with another
+func isPrefix(prefix []string, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// helper for parsing an array index, size allows appending at the end
+func index(token string, size int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > size || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index '%s': %w", token, ErrInvalidPatch)
+	}
+	return i, nil
+}
+
+// get finds the value at a path
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member '%s' not found: %w", token, ErrInvalidPatch)
+			}
+			node = child
+		case []any:
+			i, err := index(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("cannot get '%s' of a scalar: %w", token, ErrInvalidPatch)
+		}
+	}
+	return node, nil
+}
+
+// add sets a member or inserts an array element at a path, returning the new node
+func add(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("member '%s' not found: %w", token, ErrInvalidPatch)
+		}
+		updated, err := add(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = updated
+		return n, nil
+
+	case []any:
+		if len(rest) == 0 {
+			i := len(n)
+			if token != "-" {
+				var err error
+				if i, err = index(token, len(n)); err != nil {
+					return nil, err
+				}
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		i, err := index(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		if n[i], err = add(n[i], rest, value); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	default:
+		return nil, fmt.Errorf("cannot add '%s' to a scalar: %w", token, ErrInvalidPatch)
+	}
+}
+
+// remove deletes a member or array element at a path, returning the new node and the removed value
+func remove(node any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("cannot remove the whole document: %w", ErrInvalidPatch)
+	}
+	token, rest := path[0], path[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("member '%s' not found: %w", token, ErrInvalidPatch)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		updated, removed, err := remove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = updated
+		return n, removed, nil
+
+	case []any:
+		i, err := index(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[i]
+			return append(n[:i], n[i+1:]...), removed, nil
+		}
+		updated, removed, err := remove(n[i], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = updated
+		return n, removed, nil
+
+	default:
+		return nil, nil, fmt.Errorf("cannot remove '%s' from a scalar: %w", token, ErrInvalidPatch)
+	}
+}
+
+// helper for copying decoded JSON so copies don't share maps or slices
+func deepCopy(node any) any {
+	switch n := node.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(n))
+		for k, v := range n {
+			c[k] = deepCopy(v)
+		}
+		return c
+	case []any:
+		c := make([]any, len(n))
+		for i, v := range n {
+			c[i] = deepCopy(v)
+		}
+		return c
+	default:
+		return n
+	}
+}
@@ -0,0 +1,156 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// periods with an interval are counted from this Monday so they line up the same way every time
+var epoch = time.Date(2000, time.January, 3, 0, 0, 0, 0, time.UTC)
+
+// subset of an iCalendar RRULE like FREQ=WEEKLY;INTERVAL=2
+type Rule struct {
+	Freq     string
+	Interval int
+}
+
+// Parse parses a rule like FREQ=WEEKLY;INTERVAL=2, shorthands daily, weekly, and monthly are also accepted
+func Parse(s string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "RRULE:")
+
+	switch s {
+	case FreqDaily, FreqWeekly, FreqMonthly:
+		rule.Freq = s
+		return rule, nil
+	}
+
+	for _, part := range strings.Split(s, ";") {
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return rule, fmt.Errorf("%w: %s", ErrInvalidRule, s)
+		}
+
+		switch key {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly {
+				return rule, fmt.Errorf("%w: unsupported frequency %s", ErrInvalidRule, value)
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return rule, fmt.Errorf("%w: interval must be a positive number", ErrInvalidRule)
+			}
+			rule.Interval = interval
+		default:
+			return rule, fmt.Errorf("%w: unsupported part %s", ErrInvalidRule, key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return rule, fmt.Errorf("%w: missing frequency", ErrInvalidRule)
+	}
+	return rule, nil
+}
+
+func (r Rule) String() string {
+	if r.Interval > 1 {
+		return fmt.Sprintf("FREQ=%s;INTERVAL=%d", r.Freq, r.Interval)
+	}
+	return "FREQ=" + r.Freq
+}
+
+// days between epoch and a date, ignoring time of day and daylight saving time
+func daysSinceEpoch(t time.Time) int {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int(date.Sub(epoch).Hours() / 24)
+}
+
+// positive remainder, so dates before epoch line up too
+func mod(a int, b int) int {
+	return ((a % b) + b) % b
+}
+
+// PeriodStart gets the start of the period containing a time in local time
+func (r Rule) PeriodStart(t time.Time) time.Time {
+	t = t.In(time.Local)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+
+	switch r.Freq {
+	case FreqWeekly:
+		monday := midnight.AddDate(0, 0, -mod(int(t.Weekday())-1, 7))
+		weeks := daysSinceEpoch(monday) / 7
+		return monday.AddDate(0, 0, -7*mod(weeks, r.Interval))
+	case FreqMonthly:
+		first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+		months := (t.Year()-epoch.Year())*12 + int(t.Month()-1)
+		return first.AddDate(0, -mod(months, r.Interval), 0)
+	default:
+		return midnight.AddDate(0, 0, -mod(daysSinceEpoch(midnight), r.Interval))
+	}
+}
+
+// Next gets the start of the period after a period
+func (r Rule) Next(periodStart time.Time) time.Time {
+	periodStart = periodStart.In(time.Local)
+
+	switch r.Freq {
+	case FreqWeekly:
+		return periodStart.AddDate(0, 0, 7*r.Interval)
+	case FreqMonthly:
+		return periodStart.AddDate(0, r.Interval, 0)
+	default:
+		return periodStart.AddDate(0, 0, r.Interval)
+	}
+}
+
+// Previous gets the start of the period before a period
+func (r Rule) Previous(periodStart time.Time) time.Time {
+	return r.PeriodStart(periodStart.Add(-time.Nanosecond))
+}
+
+// finished period of a recurring objective
+type Period struct {
+	Start     time.Time
+	Completed bool
+}
+
+// Streaks counts consecutive completed periods up to the current period and the longest run ever.
+// History must be sorted oldest first. The current period only adds to the streak once completed.
+func (r Rule) Streaks(history []Period, currentStart time.Time, currentCompleted bool) (int, int) {
+	streak := 0
+	best := 0
+	var expected time.Time
+
+	for _, p := range history {
+		if !p.Completed || (streak > 0 && !p.Start.Equal(expected)) {
+			streak = 0
+		}
+		if p.Completed {
+			streak++
+		}
+		best = max(best, streak)
+		expected = r.Next(p.Start)
+	}
+
+	// gap between last finished period and the current one
+	if streak > 0 && !currentStart.Equal(expected) {
+		streak = 0
+	}
+	if currentCompleted {
+		streak++
+	}
+	return streak, max(best, streak)
+}
@@ -0,0 +1,54 @@
+package scheduler
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/digest"
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/recurrence"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// SendDigests emails digests of subscribed users once per day or week, after a given hour of the day
+func SendDigests(config digest.Config, hour int) func(now time.Time) error {
+	return func(now time.Time) error {
+		subs, err := db.GetDigestSubscriptions(context.Background())
+		if err != nil {
+			return err
+		}
+
+		for _, sub := range subs {
+			rule := recurrence.Rule{Freq: recurrence.FreqDaily, Interval: 1}
+			if sub.Frequency == models.DigestWeekly {
+				rule.Freq = recurrence.FreqWeekly
+			}
+
+			sendAt := rule.PeriodStart(now).Add(time.Duration(hour) * time.Hour)
+			if now.Before(sendAt) || (sub.LastSent != nil && !sub.LastSent.Before(sendAt)) {
+				continue
+			}
+
+			d, err := digest.Build(context.Background(), sub, now)
+			if err != nil {
+				slog.Error("Failed to build digest", "user", sub.UserId, "error", err)
+				continue
+			}
+
+			// nothing to remind about, try again next period
+			if !d.IsEmpty() {
+				slog.Info("Sending digest", "user", sub.UserId, "frequency", sub.Frequency)
+
+				if err := digest.Send(config, sub.Email, d); err != nil {
+					slog.Error("Failed to send digest", "user", sub.UserId, "error", err)
+					continue
+				}
+			}
+
+			if err := db.MarkDigestSent(context.Background(), sub.UserId, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
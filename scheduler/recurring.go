@@ -0,0 +1,69 @@
+package scheduler
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/events"
+	"barrettotte/questlines/models"
+	"barrettotte/questlines/recurrence"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// ResetRecurringObjectives starts a new period for recurring objectives whose current period is over.
+// A questline that fails to reset is logged and skipped so it doesn't hold up the others
+func ResetRecurringObjectives(now time.Time) error {
+	recurring, err := db.GetRecurringObjectives(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for questlineId, objectives := range recurring {
+		due := make([]models.Objective, 0)
+		for _, o := range objectives {
+			rule, err := recurrence.Parse(o.Recurrence)
+			if err != nil {
+				slog.Warn("Skipping objective with invalid recurrence", "objective", o.Id, "recurrence", o.Recurrence)
+				continue
+			}
+			if !now.Before(rule.Next(*o.PeriodStart)) {
+				due = append(due, o)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		slog.Info("Resetting recurring objectives", "questline", questlineId, "count", len(due))
+		if err := resetQuestline(questlineId, due, now); err != nil {
+			slog.Error("Failed to reset recurring objectives", "questline", questlineId, "error", err)
+		}
+	}
+	return nil
+}
+
+// resets due objectives of a questline and publishes the changes to it and its parents
+func resetQuestline(questlineId string, due []models.Objective, now time.Time) error {
+	before, err := db.GetQuestline(context.Background(), questlineId)
+	if err != nil {
+		return err
+	}
+	if err := db.ResetRecurringObjectives(context.Background(), questlineId, due, now); err != nil {
+		return err
+	}
+	after, err := db.GetQuestline(context.Background(), questlineId)
+	if err != nil {
+		return fmt.Errorf("failed to get questline %s after reset: %w", questlineId, err)
+	}
+	events.Publish(events.Diff(before, after)...)
+
+	parents, err := db.UpdateParentQuests(context.Background(), questlineId)
+	for _, p := range parents {
+		events.Publish(events.Diff(p.Before, p.After)...)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update parent quests of questline %s: %w", questlineId, err)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Every runs a job right away and then on an interval in the background
+func Every(name string, interval time.Duration, job func(now time.Time) error) {
+	run := func(now time.Time) {
+		if err := job(now); err != nil {
+			slog.Error("Scheduled job failed", "job", name, "error", err)
+		}
+	}
+
+	go func() {
+		run(time.Now())
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			run(now)
+		}
+	}()
+	slog.Info("Scheduled job", "job", name, "interval", interval)
+}
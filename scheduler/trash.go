@@ -0,0 +1,22 @@
+package scheduler
+
+import (
+	"barrettotte/questlines/db"
+	"context"
+	"log/slog"
+	"time"
+)
+
+// PurgeTrash permanently deletes questlines and quests that were in the trash for longer than a number of days
+func PurgeTrash(days int) func(now time.Time) error {
+	return func(now time.Time) error {
+		questlines, quests, err := db.PurgeTrash(context.Background(), now.AddDate(0, 0, -days))
+		if err != nil {
+			return err
+		}
+		if questlines > 0 || quests > 0 {
+			slog.Info("Purged trash", "questlines", questlines, "quests", quests, "days", days)
+		}
+		return nil
+	}
+}
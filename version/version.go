@@ -0,0 +1,47 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// set at build time with -ldflags "-X barrettotte/questlines/version.Version=v1.2.3 -X ..."
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("Info{Version: '%v', Commit: '%v', BuildTime: '%v', GoVersion: '%v'}", i.Version, i.Commit, i.BuildTime, i.GoVersion)
+}
+
+// Get returns build info, falling back to VCS info recorded by go build when the commit was not set
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+
+	if info.Commit == "" {
+		info.Commit = "unknown"
+		if build, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range build.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					info.Commit = s.Value
+				case "vcs.time":
+					if info.BuildTime == "" {
+						info.BuildTime = s.Value
+					}
+				}
+			}
+		}
+	}
+	return info
+}
@@ -0,0 +1,291 @@
+package webhooks
+
+import (
+	"barrettotte/questlines/db"
+	"barrettotte/questlines/events"
+	"barrettotte/questlines/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	SignatureHeader = "X-Questlines-Signature" // sha256=<hex HMAC of body>
+	EventHeader     = "X-Questlines-Event"
+	DeliveryHeader  = "X-Questlines-Delivery"
+
+	// event sent when testing a webhook
+	PingEvent = "webhook.ping"
+)
+
+var (
+	MaxAttempts  = 5
+	RetryDelay   = 2 * time.Second // doubled after every failed attempt
+	PollInterval = time.Second     // how often the queue is checked for retries that are due
+
+	// max number of queued deliveries attempted at once
+	batchSize = 50
+
+	// AllowPrivateTargets permits webhooks to loopback, private and link-local addresses, for local development
+	AllowPrivateTargets = false
+
+	// addresses are checked again when connecting, since a host can resolve differently than when its webhook was created
+	client = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{Timeout: 5 * time.Second, Control: checkDial}).DialContext,
+		},
+	}
+
+	// wakes up the dispatcher when deliveries are queued
+	wake = make(chan struct{}, 1)
+)
+
+// Sign computes the signature of a payload with a webhook's secret
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ErrBlockedTarget is returned for webhooks to addresses the server won't send requests to
+var ErrBlockedTarget = errors.New("webhook target address is not allowed")
+
+// helper for checking if an address is internal to the server or its network
+func isBlocked(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified()
+}
+
+// CheckHost resolves a webhook host and checks none of its addresses are internal
+func CheckHost(ctx context.Context, host string) error {
+	if AllowPrivateTargets {
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if isBlocked(addr) {
+			return fmt.Errorf("%s resolves to %s: %w", host, addr, ErrBlockedTarget)
+		}
+	}
+	return nil
+}
+
+// checks the resolved address of a delivery before connecting to it
+func checkDial(network string, address string, _ syscall.RawConn) error {
+	if AllowPrivateTargets {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("failed to parse address %s: %w", address, err)
+	}
+	if isBlocked(addrPort.Addr()) {
+		return fmt.Errorf("%s: %w", addrPort.Addr(), ErrBlockedTarget)
+	}
+	return nil
+}
+
+// Start queues questline events for matching webhooks and delivers them in the background.
+// Deliveries are kept in the database until they succeed or run out of attempts, so none are lost to slow
+// webhooks or restarts
+func Start() {
+	events.AddSink(enqueue)
+
+	go func() {
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+
+		for {
+			dispatch()
+			select {
+			case <-wake:
+			case <-ticker.C:
+			}
+		}
+	}()
+	slog.Info("Started webhook dispatcher")
+}
+
+// queues published events for every webhook that matches them
+func enqueue(changes []events.Event) {
+	queued := false
+	for _, e := range changes {
+		hooks, err := db.GetQuestlineWebhooks(context.Background(), e.QuestlineId, e.UserId)
+		if err != nil {
+			slog.Error("Failed to get webhooks", "event", e.Id, "type", e.Type, "error", err)
+			continue
+		}
+
+		payload, err := json.Marshal(e)
+		if err != nil {
+			slog.Error("Failed to marshal event", "event", e.Id, "type", e.Type, "error", err)
+			continue
+		}
+
+		for _, hook := range hooks {
+			if !events.Matches(hook.Events, e.Type) {
+				continue
+			}
+			delivery := models.QueuedWebhookDelivery{Webhook: hook, EventId: e.Id, EventType: e.Type, Payload: string(payload)}
+			if err := db.QueueWebhookDelivery(context.Background(), &delivery); err != nil {
+				slog.Error("Failed to queue webhook delivery", "event", e.Id, "type", e.Type, "webhook", hook.Id, "error", err)
+				continue
+			}
+			queued = true
+		}
+	}
+
+	if queued {
+		select {
+		case wake <- struct{}{}:
+		default: // dispatcher is already woken up
+		}
+	}
+}
+
+// attempts queued deliveries that are due until none are left, each at most once so a delivery
+// that can't be taken off the queue isn't attempted over and over
+func dispatch() {
+	attempted := make(map[string]bool)
+	for {
+		due, err := db.GetDueWebhookDeliveries(context.Background(), time.Now(), batchSize)
+		if err != nil {
+			slog.Error("Failed to get queued webhook deliveries", "error", err)
+			return
+		}
+		due = slices.DeleteFunc(due, func(d models.QueuedWebhookDelivery) bool {
+			return attempted[d.Id]
+		})
+		if len(due) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, d := range due {
+			attempted[d.Id] = true
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				attempt(d)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// makes the next attempt of a queued delivery, retrying failed attempts with exponential backoff
+func attempt(queued models.QueuedWebhookDelivery) {
+	var e events.Event
+	if err := json.Unmarshal([]byte(queued.Payload), &e); err != nil {
+		slog.Error("Failed to unmarshal queued event", "event", queued.EventId, "webhook", queued.Webhook.Id, "error", err)
+		finish(queued)
+		return
+	}
+
+	attempts := queued.Attempts + 1
+	delivery := DeliverOnce(queued.Webhook, e, attempts)
+	if delivery.Success || !shouldRetry(delivery.StatusCode) {
+		finish(queued)
+		return
+	}
+	if attempts >= MaxAttempts {
+		slog.Warn("Gave up delivering event", "event", e.Id, "type", e.Type, "webhook", queued.Webhook.Id, "attempts", attempts)
+		finish(queued)
+		return
+	}
+
+	next := time.Now().Add(RetryDelay << (attempts - 1))
+	if err := db.RescheduleWebhookDelivery(context.Background(), queued.Id, attempts, next); err != nil {
+		slog.Error("Failed to reschedule webhook delivery", "event", e.Id, "webhook", queued.Webhook.Id, "error", err)
+	}
+}
+
+// removes a delivery that is done from the queue
+func finish(queued models.QueuedWebhookDelivery) {
+	if err := db.DeleteQueuedWebhookDelivery(context.Background(), queued.Id); err != nil {
+		slog.Error("Failed to remove webhook delivery from queue", "event", queued.EventId, "webhook", queued.Webhook.Id, "error", err)
+	}
+}
+
+// DeliverOnce makes a single delivery attempt of an event and records it in the delivery log
+func DeliverOnce(hook models.Webhook, e events.Event, attempt int) models.WebhookDelivery {
+	delivery := models.WebhookDelivery{WebhookId: hook.Id, EventId: e.Id, EventType: e.Type, Attempt: attempt}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		delivery.Error = fmt.Sprintf("failed to marshal event: %v", err)
+		record(&delivery)
+		return delivery
+	}
+	delivery.Payload = string(payload)
+
+	start := time.Now()
+	statusCode, err := post(hook, e, payload)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	delivery.StatusCode = statusCode
+
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.Success = statusCode >= 200 && statusCode < 300
+	}
+
+	if !delivery.Success {
+		slog.Warn("Failed delivering event",
+			"event", e.Id, "type", e.Type, "webhook", hook.Id, "attempt", attempt, "status", statusCode, "error", delivery.Error,
+		)
+	}
+	record(&delivery)
+	return delivery
+}
+
+func post(hook models.Webhook, e events.Event, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "questlines-webhook")
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, payload))
+	req.Header.Set(EventHeader, e.Type)
+	req.Header.Set(DeliveryHeader, e.Id)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
+
+// retry network errors, server errors, and rate limiting
+func shouldRetry(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func record(delivery *models.WebhookDelivery) {
+	if err := db.CreateWebhookDelivery(context.Background(), delivery); err != nil {
+		slog.Error("Failed to record webhook delivery", "webhook", delivery.WebhookId, "error", err)
+	}
+}